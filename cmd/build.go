@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+	"github.com/kyco/godevwatch/internal/process"
+	"github.com/kyco/godevwatch/internal/proxy"
+	"github.com/spf13/cobra"
+)
+
+var buildJSON bool
+
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Run the build rules once and exit",
+	Long: `Runs the setup commands and the build rules that run on startup once, in dependency order, and exits
+with a non-zero status if a build fails. Nothing is watched or proxied, which makes it suitable
+for CI. With --json the logs go to stderr and a JSON summary of every rule is printed to stdout.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if debugMode {
+			cfg.LogLevel = config.LogLevelDebug
+			cfg.DebugMode = true
+		}
+
+		// A failed build isn't a usage error
+		cmd.SilenceUsage = true
+		if err := buildOnce(cfg, buildJSON); err != nil {
+			cmd.SilenceErrors = true
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	buildCmd.Flags().BoolVar(&buildJSON, "json", false, "Print a JSON summary of the build to stdout (logs go to stderr)")
+	buildCmd.Flags().BoolVar(&debugMode, "debug", false, "Show build and watcher details")
+	rootCmd.AddCommand(buildCmd)
+}
+
+// buildSummary is the result of a one-shot build, printed as JSON for scripts
+type buildSummary struct {
+	Success bool               `json:"success"`
+	Rules   []build.RuleResult `json:"rules"`
+}
+
+// buildOnce runs the setup commands and the startup build rules once, without watcher,
+// proxy server or backend. With jsonOutput the logs go to stderr and a buildSummary is
+// written to stdout.
+func buildOnce(cfg *config.Config, jsonOutput bool) error {
+	proxy.SetupLogging(cfg)
+	defer logger.CloseLogFiles()
+	if jsonOutput {
+		logger.SetOutput(os.Stderr)
+	}
+
+	if err := process.Setup(cfg); err != nil {
+		return err
+	}
+
+	store := build.NewStore()
+	if err := build.PersistHistory(cfg, store); err != nil {
+		logger.Warnf("[build] Warning: failed to open build history: %v\n", err)
+	}
+
+	results, buildErr := build.RunAllResults(cfg, store)
+
+	if !cfg.KeepStatus {
+		if err := build.RemoveStatusFiles(); err != nil {
+			logger.Warnf("[build] Warning: failed to remove build status files: %v\n", err)
+		}
+	}
+
+	if jsonOutput {
+		summary := buildSummary{Success: buildErr == nil, Rules: results}
+		if summary.Rules == nil {
+			summary.Rules = []build.RuleResult{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summary); err != nil {
+			return fmt.Errorf("failed to write build summary: %w", err)
+		}
+	}
+
+	if buildErr != nil {
+		logger.Errorf("[build] \033[31m%v\033[0m\n", buildErr)
+		return buildErr
+	}
+	logger.Infof("[build] \033[32m✓ Build completed successfully\033[0m\n")
+	return nil
+}
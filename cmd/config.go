@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configJSON bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Print the effective configuration",
+	Long:  `Loads the config file, applies defaults and prints the resulting configuration as YAML (or JSON with --json). Nothing is started and no files are written.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		out, err := yaml.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		if !configJSON {
+			fmt.Printf("# Effective configuration from %s\n%s", cfg.Path, out)
+			return nil
+		}
+
+		// Go through YAML so the JSON uses the same keys as the config file
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(out, &doc); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+	},
+}
+
+func init() {
+	configCmd.Flags().BoolVar(&configJSON, "json", false, "Print JSON instead of YAML")
+	rootCmd.AddCommand(configCmd)
+}
@@ -3,23 +3,31 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/kyco/godevwatch/internal/config"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
 
+var initTemplate string
+var initMinimal bool
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new godevwatch.yaml configuration file",
-	Long:  `Creates a godevwatch.yaml file in the current directory with default settings.`,
+	Long: `Creates a godevwatch.yaml file in the current directory (or at --config) with build rules for the detected
+project (templ, Tailwind CSS, npm). When run in a terminal it asks for the ports and lets you
+confirm the rules; --template skips the questions and --minimal writes the plain Go config.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.ResolvePath(configPath)
+
 		// Check if config already exists
-		if _, err := os.Stat("godevwatch.yaml"); err == nil {
+		if _, err := os.Stat(path); err == nil {
 			// Prompt user for confirmation with interactive select
 			prompt := promptui.Select{
-				Label: "godevwatch.yaml already exists. Overwrite?",
-				Items: []string{"Yes", "No"},
+				Label:     fmt.Sprintf("%s already exists. Overwrite?", path),
+				Items:     []string{"Yes", "No"},
 				CursorPos: 0, // Default to "Yes"
 			}
 
@@ -34,16 +42,111 @@ var initCmd = &cobra.Command{
 			}
 		}
 
-		// Create default config
-		if err := config.Init(); err != nil {
+		// Pick the options from the flags, the wizard or the detected project
+		opts := config.DefaultInitOptions()
+		var err error
+		switch {
+		case initMinimal:
+		case initTemplate != "":
+			opts, err = config.TemplateOptions(initTemplate)
+		case isInteractive():
+			opts, err = runInitWizard(config.Detect("."))
+		default:
+			opts = config.Detect(".")
+		}
+		if err != nil {
+			return err
+		}
+
+		// Create config
+		if err := config.InitWith(path, opts); err != nil {
 			return fmt.Errorf("failed to create config: %w", err)
 		}
 
-		fmt.Println("✓ Created godevwatch.yaml")
+		fmt.Printf("✓ Created %s\n", path)
 		return nil
 	},
 }
 
+// runInitWizard asks for the ports and confirms the detected rules, or asks for a project type
+func runInitWizard(detected config.InitOptions) (config.InitOptions, error) {
+	opts := detected
+
+	proxyPort, err := promptPort("Proxy port", opts.ProxyPort)
+	if err != nil {
+		return opts, err
+	}
+	backendPort, err := promptPort("Backend port", opts.BackendPort)
+	if err != nil {
+		return opts, err
+	}
+
+	confirm := promptui.Select{
+		Label: fmt.Sprintf("Detected %s. Use the matching build rules?", detected.Describe()),
+		Items: []string{"Yes", "No, choose a project type"},
+	}
+	choice, _, err := confirm.Run()
+	if err != nil {
+		return opts, fmt.Errorf("prompt failed: %w", err)
+	}
+	if choice == 0 {
+		opts.ProxyPort = proxyPort
+		opts.BackendPort = backendPort
+		return opts, nil
+	}
+
+	prompt := promptui.Select{
+		Label: "Project type",
+		Items: []string{
+			"Go (single binary)",
+			"Web (Go + Tailwind CSS)",
+			"Fullstack (Go + templ + Tailwind CSS)",
+		},
+	}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return opts, fmt.Errorf("prompt failed: %w", err)
+	}
+
+	opts, err = config.TemplateOptions(config.Templates[index])
+	if err != nil {
+		return opts, err
+	}
+	opts.ProxyPort = proxyPort
+	opts.BackendPort = backendPort
+	return opts, nil
+}
+
+// promptPort asks for a port number, offering def as the default
+func promptPort(label string, def int) (int, error) {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: strconv.Itoa(def),
+		Validate: func(input string) error {
+			port, err := strconv.Atoi(input)
+			if err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("enter a port between 1 and 65535")
+			}
+			return nil
+		},
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
+		return 0, fmt.Errorf("prompt failed: %w", err)
+	}
+	return strconv.Atoi(result)
+}
+
+// isInteractive reports whether stdin is a terminal that can answer prompts
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func init() {
 	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolVar(&initMinimal, "minimal", false, "Write the plain Go config without detecting the project")
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "", "Project template to generate without prompting: go, web or fullstack")
 }
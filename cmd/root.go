@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/kyco/godevwatch/internal/config"
@@ -8,36 +9,134 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var version = "0.1.0"
 var debugMode bool
+var quietMode bool
+var silentMode bool
+var watchOnly bool
+var configPath string
+var openBrowser bool
+var keepStatus bool
+var noOpenBrowser bool
+var configCheck bool
 
 var rootCmd = &cobra.Command{
 	Use:   "godevwatch",
 	Short: "A development proxy tool",
 	Long:  `godevwatch is a CLI tool that starts a proxy server for development purposes.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only validate the config: silent on success, just the error otherwise
+		if configCheck {
+			cmd.SilenceUsage = true
+			_, err := checkConfig()
+			return err
+		}
+
 		// Load configuration
-		cfg, err := config.Load()
+		cfg, err := loadConfig()
 		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
+			// A broken config isn't a usage error
+			cmd.SilenceUsage = true
+			return err
+		}
+
+		// Flags override log_level
+		if debugMode && (quietMode || silentMode) {
+			return fmt.Errorf("--debug can't be combined with --quiet or --silent")
+		}
+		switch {
+		case debugMode:
+			cfg.LogLevel = config.LogLevelDebug
+			cfg.DebugMode = true
+		case silentMode:
+			cfg.LogLevel = config.LogLevelSilent
+			cfg.DebugMode = false
+		case quietMode:
+			cfg.LogLevel = config.LogLevelError
+			cfg.DebugMode = false
+		}
+
+		if keepStatus {
+			cfg.KeepStatus = true
+		}
+
+		// Flags override open_browser
+		if openBrowser && noOpenBrowser {
+			return fmt.Errorf("--open and --no-open can't be used together")
+		}
+		if openBrowser {
+			cfg.OpenBrowser = true
+		}
+		if noOpenBrowser {
+			cfg.OpenBrowser = false
+		}
+
+		// Supervise the workspaces, each with its own config, behind one proxy
+		if len(cfg.Workspaces) > 0 {
+			return proxy.StartWorkspaces(cfg)
 		}
 
-		// Set debug mode in config
-		cfg.DebugMode = debugMode
+		// Only rebuild on changes, without proxy or backend
+		if watchOnly {
+			cfg.Mode = config.ModeWatch
+		}
+		if cfg.Mode == config.ModeWatch {
+			return proxy.Watch(cfg)
+		}
 
 		// Start proxy server
 		return proxy.Start(cfg)
 	},
 }
 
+// loadConfig loads the config file, with a hint on how to fix the common problems
+func loadConfig() (*config.Config, error) {
+	path := config.ResolvePath(configPath)
+	cfg, err := config.Load(path)
+
+	var parseErr *config.ParseError
+	var validationErr *config.ValidationError
+	switch {
+	case err == nil:
+		return cfg, nil
+	case errors.Is(err, config.ErrConfigNotFound):
+		return nil, fmt.Errorf("%s not found. Run 'godevwatch init' to create one, or pass its path with --config", path)
+	case errors.As(err, &parseErr):
+		return nil, fmt.Errorf("failed to load config: %w (check the indentation and quoting around that line)", err)
+	case errors.As(err, &validationErr):
+		return nil, fmt.Errorf("invalid config: %w (fix %s in %s)", err, validationErr.Field, path)
+	default:
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
 
 func init() {
-	rootCmd.Version = version
+	rootCmd.Version = readBuildInfo().String()
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information")
 
+	// Config file location, shared by all commands
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Path to the config file (default $GODEVWATCH_CONFIG or ./godevwatch.yaml)")
+
 	// Debug flag to show verbose logging
 	rootCmd.Flags().BoolVar(&debugMode, "debug", false, "Enable debug mode (show all logs including build and watcher details)")
+
+	// Open the proxy in the browser on startup
+	rootCmd.Flags().BoolVar(&openBrowser, "open", false, "Open the proxy in the default browser on startup")
+	rootCmd.Flags().BoolVar(&noOpenBrowser, "no-open", false, "Don't open the browser, even if open_browser is set")
+
+	// Quiet flags to only show errors and warnings
+	rootCmd.Flags().BoolVarP(&quietMode, "quiet", "q", false, "Only log errors and warnings (build and backend output is still shown)")
+	rootCmd.Flags().BoolVar(&silentMode, "silent", false, "Only log errors and warnings, and hide build and backend output")
+
+	// Keep the build status files on shutdown
+	rootCmd.Flags().BoolVar(&keepStatus, "keep-status", false, "Keep the build status files on shutdown for inspection")
+
+	// Validate the config and exit, for pre-commit hooks and editors
+	rootCmd.Flags().BoolVar(&configCheck, "config-check", false, "Validate the config and exit (no output unless it is invalid)")
+
+	// Watch-only flag to run the build rules without proxy or backend
+	rootCmd.Flags().BoolVar(&watchOnly, "watch-only", false, "Only rebuild on file changes (no proxy server or backend)")
 }
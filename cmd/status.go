@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var showHistory bool
+var historyLimit int
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the build status of a running godevwatch",
+	Long:  `Queries the running proxy for the current build status, or with --history lists recent builds from the persisted history file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if showHistory {
+			return printHistory(cfg)
+		}
+
+		// Ask the running proxy for its current status
+		url := cfg.ProxyURL() + cfg.InternalPath("build-status")
+		client := &http.Client{Timeout: 2 * time.Second}
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("godevwatch does not seem to be running on port %d: %w", cfg.ProxyPort, err)
+		}
+		defer resp.Body.Close()
+
+		var status build.BuildStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return fmt.Errorf("failed to read build status: %w", err)
+		}
+
+		if status.Building {
+			fmt.Println("Building...")
+		}
+		if status.LastBuild != nil {
+			fmt.Print("Last build: ")
+			printRecord(*status.LastBuild)
+		} else if !status.Building {
+			fmt.Println("No builds yet")
+		}
+		for _, rule := range status.Rules {
+			printRuleState(rule)
+		}
+		return nil
+	},
+}
+
+// printHistory lists the most recent builds from the history file
+func printHistory(cfg *config.Config) error {
+	if !cfg.PersistHistory {
+		fmt.Printf("Build history is not persisted. Set persist_history: true in %s\n", cfg.Path)
+		return nil
+	}
+
+	records, err := build.ReadHistory(cfg.HistoryFile)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("No builds recorded yet")
+		return nil
+	}
+
+	if historyLimit > 0 && len(records) > historyLimit {
+		records = records[len(records)-historyLimit:]
+	}
+	for _, record := range records {
+		printRecord(record)
+	}
+	return nil
+}
+
+// printRecord prints a single build on one line
+func printRecord(record build.BuildRecord) {
+	color := "\033[32m"
+	switch record.Status {
+	case build.StatusFailed:
+		color = "\033[31m"
+	case build.StatusAborted, build.StatusBuilding:
+		color = "\033[33m"
+	}
+
+	finished := time.Unix(record.Timestamp, 0)
+	duration := time.Duration(record.Timestamp-record.StartedAt) * time.Second
+	fmt.Printf("%s  %s%-8s\033[0m  %-20s %s (%s)\n",
+		finished.Format("2006-01-02 15:04:05"), color, record.Status, record.RuleName, record.BuildID, duration)
+}
+
+// printRuleState prints where a rule is in the build schedule
+func printRuleState(rule build.RuleState) {
+	color := "\033[0m"
+	switch rule.State {
+	case build.StatusSuccess:
+		color = "\033[32m"
+	case build.StatusFailed:
+		color = "\033[31m"
+	case build.StatusBuilding, build.RuleQueued, build.RuleBlocked:
+		color = "\033[33m"
+	}
+
+	if rule.WaitingFor != "" {
+		fmt.Printf("  %-20s %s%s\033[0m (waiting for %s)\n", rule.Rule, color, rule.State, rule.WaitingFor)
+	} else {
+		fmt.Printf("  %-20s %s%s\033[0m\n", rule.Rule, color, rule.State)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&showHistory, "history", false, "List recent builds, including those from previous runs")
+	statusCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Number of builds to list with --history (0 for all)")
+}
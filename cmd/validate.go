@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration and summarize it",
+	Long: `Loads and validates the config file, then prints a short report of the backends and build rules
+it defines. Exits with a non-zero status if the config is invalid. For a silent check in scripts
+and git hooks, use "godevwatch --config-check".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := checkConfig()
+		if err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+
+		// checkConfig has already ordered the rules without error
+		rules, _ := cfg.OrderedRules()
+		fmt.Printf("✓ %s is valid\n", cfg.Path)
+		for _, backend := range cfg.Backends {
+			fmt.Printf("  Backend %s: %s -> %s\n", backend.Name, backend.PathPrefix, backend.URL)
+		}
+		fmt.Printf("  %d build rule(s), in build order:\n", len(rules))
+		for _, rule := range rules {
+			watch := strings.Join(append(append([]string(nil), rule.Watch...), rule.Files...), ", ")
+			fmt.Printf("    - %s (%s)\n", rule.Name, watch)
+		}
+		return nil
+	},
+}
+
+// checkConfig loads and validates the config file. It backs both validate and --config-check.
+func checkConfig() (*config.Config, error) {
+	return loadConfig()
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultVersion is reported when neither -ldflags nor go install provide a version
+const defaultVersion = "0.1.0"
+
+// Build metadata, set at build time with
+// -ldflags "-X github.com/kyco/godevwatch/cmd.version=... -X ...cmd.commit=... -X ...cmd.buildDate=..."
+var (
+	version   = defaultVersion
+	commit    = ""
+	buildDate = ""
+)
+
+var versionVerbose bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version",
+	Long:  `Prints the godevwatch version. With --verbose it also prints the git commit, build date and Go version, which help when reporting a bug.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		info := readBuildInfo()
+		if !versionVerbose {
+			fmt.Println(info.String())
+			return
+		}
+
+		fmt.Printf("Version:    %s\n", info.Version)
+		fmt.Printf("Commit:     %s\n", orUnknown(info.Commit))
+		fmt.Printf("Built:      %s\n", orUnknown(info.Date))
+		fmt.Printf("Go version: %s\n", info.GoVersion)
+		fmt.Printf("Platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	},
+}
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+}
+
+// String returns the version with the short commit and build date, if known
+func (b buildInfo) String() string {
+	s := b.Version
+	switch {
+	case b.Commit != "" && b.Date != "":
+		s += fmt.Sprintf(" (%s, %s)", shortCommit(b.Commit), b.Date)
+	case b.Commit != "":
+		s += fmt.Sprintf(" (%s)", shortCommit(b.Commit))
+	}
+	return s
+}
+
+// readBuildInfo returns the metadata set through -ldflags, falling back to what the Go
+// toolchain embeds in the binary (module version for go install, VCS details for go build)
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: buildDate, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if v := bi.Main.Version; v != "" && v != "(devel)" && version == defaultVersion {
+		info.Version = v
+	}
+
+	modified := false
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if modified && commit == "" && info.Commit != "" {
+		info.Commit += "-dirty"
+	}
+
+	return info
+}
+
+// shortCommit abbreviates a commit hash to 7 characters
+func shortCommit(c string) string {
+	hash, dirty := strings.CutSuffix(c, "-dirty")
+	if len(hash) > 7 {
+		hash = hash[:7]
+	}
+	if dirty {
+		hash += "-dirty"
+	}
+	return hash
+}
+
+// orUnknown returns s, or "unknown" if it's empty
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionVerbose, "verbose", false, "Also print the commit, build date and Go version")
+	rootCmd.AddCommand(versionCmd)
+}
@@ -1,53 +1,201 @@
 package build
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/kyco/godevwatch/internal/config"
 	"github.com/kyco/godevwatch/internal/logger"
 )
 
-// RunAll executes all build rules in order
-func RunAll(cfg *config.Config) error {
+// Results of rules that didn't build
+const (
+	ResultSkipped = "skipped" // initial: false, or when_cmd failed
+	ResultNotRun  = "not_run" // An earlier rule failed
+)
+
+// RuleResult is the outcome of a single rule in RunAllResults
+type RuleResult struct {
+	Rule       string `json:"rule"`
+	Status     string `json:"status"` // success, failed, skipped or not_run
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"` // First error line of a failed build
+}
+
+// RunAll executes the build rules that run on startup in dependency order, reporting their
+// status to store (which may be nil)
+func RunAll(cfg *config.Config, store *Store) error {
+	_, err := RunAllResults(cfg, store)
+	return err
+}
+
+// RunAllResults is RunAll, also returning the result of every rule in the order they ran
+func RunAllResults(cfg *config.Config, store *Store) ([]RuleResult, error) {
+	rules, err := cfg.OrderedRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RuleResult
+	var failed error
+	for _, rule := range rules {
+		switch {
+		case failed != nil:
+			results = append(results, RuleResult{Rule: rule.Name, Status: ResultNotRun})
+		case !rule.RunsInitially():
+			logger.Printf("[build] Skipping %s in the initial build (initial: false)\n", rule.Name)
+			results = append(results, RuleResult{Rule: rule.Name, Status: ResultSkipped})
+		case !GuardPasses(&rule):
+			results = append(results, RuleResult{Rule: rule.Name, Status: ResultSkipped})
+		default:
+			var result RuleResult
+			result, failed = run(cfg, store, rule)
+			results = append(results, result)
+		}
+	}
+
+	return results, failed
+}
+
+// run executes a single build rule with status tracking
+func run(cfg *config.Config, store *Store, rule config.BuildRule) (RuleResult, error) {
+	result := RuleResult{Rule: rule.Name, Status: StatusFailed}
+	start := time.Now()
+
 	// Initialize tracker
-	tracker := NewTracker(cfg.BuildStatusDir, cfg.DebugMode)
+	tracker := NewTracker(store, cfg.BuildStatusDir, rule.Name, cfg.KeepStatus)
 
 	// Start tracking
 	if err := tracker.Start(); err != nil {
-		return fmt.Errorf("failed to start build tracking: %w", err)
+		return result, fmt.Errorf("failed to start build tracking: %w", err)
+	}
+
+	logger.Printf("[build] Running build: %s\n", rule.Name)
+
+	// Generated code must be in place before the command runs
+	output := &OutputBuffer{}
+	name := "godevwatch-" + tracker.GetBuildID()
+	err := Generate(context.Background(), &rule, name, output)
+	if err == nil {
+		output, err = runWithRetries(cfg, &rule, name)
 	}
+	result.DurationMs = time.Since(start).Milliseconds()
 
-	// Track build failure if something goes wrong
-	var buildErr error
-	defer func() {
-		if buildErr != nil {
-			if err := tracker.Fail(); err != nil {
-				logger.Printf("[build] Warning: failed to mark build as failed: %v\n", err)
-			}
+	if err != nil {
+		// Track build failure
+		tracker.Diagnose(rule.Parser, output.Bytes())
+		if err := tracker.Fail(); err != nil {
+			logger.Warnf("[build] Warning: failed to mark build as failed: %v\n", err)
 		}
-	}()
+		result.Error = firstErrorLine(&rule, output.Bytes(), err)
+		return result, fmt.Errorf("build failed (%s): %w", rule.Name, err)
+	}
 
-	for _, rule := range cfg.BuildRules {
-		logger.Printf("[build] Running build: %s\n", rule.Name)
+	logger.Printf("[build] ✓ Build completed: %s\n", rule.Name)
 
-		cmd := exec.Command("sh", "-c", rule.Command)
-		cmd.Stdout = logger.NewPrefixWriter("[build] ", os.Stdout)
-		cmd.Stderr = logger.NewPrefixWriter("[build] ", os.Stderr)
+	// Mark build as complete
+	if err := tracker.Complete(); err != nil {
+		return result, fmt.Errorf("failed to complete build tracking: %w", err)
+	}
 
-		if err := cmd.Run(); err != nil {
-			buildErr = fmt.Errorf("build failed (%s): %w", rule.Name, err)
-			return buildErr
+	result.Status = StatusSuccess
+	return result, nil
+}
+
+// runWithRetries runs the rule's command, retrying a failure up to rule.Retries times, and
+// returns the output of the last attempt
+func runWithRetries(cfg *config.Config, rule *config.BuildRule, name string) (*OutputBuffer, error) {
+	for attempt := 1; ; attempt++ {
+		output := &OutputBuffer{}
+		timedOut, err := runAttempt(cfg, rule, name, output)
+		if err == nil || attempt > rule.Retries || (timedOut && !rule.RetryOnTimeout) {
+			return output, err
 		}
+		logger.Warnf("[build] \033[33m%s failed: %v (retrying in %s, attempt %d/%d)\033[0m\n",
+			rule.Name, err, rule.RetryDelay, attempt+1, rule.Retries+1)
+		time.Sleep(rule.RetryDelay)
+	}
+}
 
-		logger.Printf("[build] ✓ Build completed: %s\n", rule.Name)
+// runAttempt runs the rule's command steps once, collecting their output, and reports
+// whether they were killed for running longer than initial_build_timeout
+func runAttempt(cfg *config.Config, rule *config.BuildRule, name string, output *OutputBuffer) (bool, error) {
+	ctx := context.Background()
+	if cfg.InitialBuildTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.InitialBuildTimeout)
+		defer cancel()
 	}
 
-	// Mark build as complete
-	if err := tracker.Complete(); err != nil {
-		return fmt.Errorf("failed to complete build tracking: %w", err)
+	err := CheckOutput(rule, output.Bytes(), runSteps(ctx, rule, name, output))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if rule.Container != nil {
+			StopContainer(name)
+		}
+		return true, fmt.Errorf("timed out after %s (initial_build_timeout)", cfg.InitialBuildTimeout)
 	}
+	return false, err
+}
 
+// runSteps runs the rule's command steps in order, stopping at the first one that fails
+func runSteps(ctx context.Context, rule *config.BuildRule, name string, output *OutputBuffer) error {
+	for i, step := range rule.Command {
+		if len(rule.Command) > 1 {
+			logger.Printf("[build] %s: step %d/%d: %s\n", rule.Name, i+1, len(rule.Command), step)
+		}
+
+		cmd, err := Command(ctx, rule, step, name)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = io.MultiWriter(logger.NewPrefixWriter("[build] ", logger.Output(), logger.BuildLog), output)
+		cmd.Stderr = io.MultiWriter(logger.NewPrefixWriter("[build] ", os.Stderr, logger.BuildLog), output)
+		// Don't wait for background processes of a killed command that still hold its output open
+		cmd.WaitDelay = time.Second
+
+		if err := cmd.Run(); err != nil {
+			return StepError(rule.Command, i, err)
+		}
+	}
 	return nil
 }
+
+// StepError names the failed step of a command with several steps
+func StepError(steps config.Commands, i int, err error) error {
+	if len(steps) == 1 {
+		return err
+	}
+	return fmt.Errorf("step %d/%d (%s) failed: %w", i+1, len(steps), steps[i], err)
+}
+
+// firstErrorLine returns the first error of a failed build's output: the first diagnostic of
+// the rule's parser, else the first line mentioning an error, else the first line of output.
+// Without output it returns err's message.
+func firstErrorLine(rule *config.BuildRule, output []byte, err error) string {
+	diagnostics, raw := ParseDiagnostics(rule.Parser, output)
+	if len(diagnostics) > 0 {
+		d := diagnostics[0]
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	}
+
+	first := ""
+	for _, line := range raw {
+		line = strings.TrimSpace(line)
+		if strings.Contains(strings.ToLower(line), "error") {
+			return line
+		}
+		// Skip go's "# package" headers
+		if first == "" && line != "" && !strings.HasPrefix(line, "#") {
+			first = line
+		}
+	}
+	if first != "" {
+		return first
+	}
+	return err.Error()
+}
@@ -0,0 +1,117 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// created records the status files and directories written by this process, so cleanup
+// never touches anything else
+var created = struct {
+	sync.Mutex
+	files map[string]bool
+	dirs  map[string]bool
+}{files: make(map[string]bool), dirs: make(map[string]bool)}
+
+// ensureDir creates dir if needed, recording every directory it had to create
+func ensureDir(dir string) error {
+	var missing []string
+	for d := filepath.Clean(dir); d != "." && d != string(filepath.Separator); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	created.Lock()
+	defer created.Unlock()
+	for _, d := range missing {
+		created.dirs[d] = true
+	}
+	return nil
+}
+
+// writeStatusFile atomically writes a status file and records it for cleanup
+func writeStatusFile(path string, data []byte) error {
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	created.Lock()
+	defer created.Unlock()
+	created.files[path] = true
+	return nil
+}
+
+// WritePersistentFile atomically writes a file in build_status_dir that outlives the process,
+// like a cache. Directories it creates are recorded for cleanup like those of status files,
+// but the file itself is never removed.
+func WritePersistentFile(path string, data []byte) error {
+	if err := ensureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes a file through a temporary file that is renamed into place, so
+// readers never see it half-written. The temporary name is unique, so several processes
+// sharing a directory don't collide.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// RemoveStatusFiles deletes the status files written by this process, then the directories it
+// created if they ended up empty. Files written by others are left alone, so build_status_dir
+// may point at a shared location.
+func RemoveStatusFiles() error {
+	created.Lock()
+	defer created.Unlock()
+
+	var firstErr error
+	for path := range created.files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+		delete(created.files, path)
+	}
+
+	// Deepest directories first, leaving any that still contain other files
+	dirs := make([]string, 0, len(created.dirs))
+	for dir := range created.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		os.Remove(dir)
+		delete(created.dirs, dir)
+	}
+
+	return firstErr
+}
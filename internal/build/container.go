@@ -0,0 +1,85 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// Command creates the command that runs command for rule: through sh on the host or, when
+// the rule has a container, through "docker run" in a container called name. Only
+// interactive rules read from the terminal; others get an empty stdin, so a prompt fails
+// the build instead of hanging it.
+func Command(ctx context.Context, rule *config.BuildRule, command, name string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if rule.Container == nil {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	} else {
+		if _, err := exec.LookPath("docker"); err != nil {
+			return nil, fmt.Errorf("rule %q runs in a container, but docker was not found in PATH", rule.Name)
+		}
+		args, err := dockerArgs(rule.Container, command, name, rule.Interactive)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(ctx, "docker", args...)
+	}
+
+	// A nil Stdin reads from os.DevNull
+	if rule.Interactive {
+		cmd.Stdin = os.Stdin
+	}
+	return cmd, nil
+}
+
+// dockerArgs builds the "docker run" arguments that run command in container c, keeping
+// stdin open for interactive rules
+func dockerArgs(c *config.Container, command, name string, interactive bool) ([]string, error) {
+	project, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	args := []string{"run", "--rm", "--name", name,
+		"-v", project + ":" + c.Workdir,
+		"-w", c.Workdir,
+	}
+	if interactive {
+		args = append(args, "-i")
+	}
+	for _, volume := range c.Volumes {
+		args = append(args, "-v", hostVolume(volume))
+	}
+	return append(args, c.Image, "sh", "-c", command), nil
+}
+
+// hostVolume makes the host side of a "host:container" mount absolute, as docker requires
+func hostVolume(volume string) string {
+	host, rest, ok := strings.Cut(volume, ":")
+	if !ok {
+		return volume // Named or anonymous volume
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && (host == "~" || strings.HasPrefix(host, "~/")) {
+		host = filepath.Join(home, strings.TrimPrefix(host, "~"))
+	} else if strings.HasPrefix(host, ".") {
+		if abs, err := filepath.Abs(host); err == nil {
+			host = abs
+		}
+	}
+	return host + ":" + rest
+}
+
+// StopContainer stops a build's container. Killing the docker client doesn't stop the
+// container itself.
+func StopContainer(name string) {
+	if out, err := exec.Command("docker", "stop", "--time", "0", name).CombinedOutput(); err != nil {
+		logger.Warnf("[build] Failed to stop container %s: %v %s\n", name, err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// Diagnostic is a single error parsed from build output
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// goErrorPattern matches "./main.go:12:5: undefined: foo" (the column is optional)
+var goErrorPattern = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// ParseDiagnostics parses build output with the named parser. Parsing is best effort: lines
+// that aren't recognized are returned as raw output.
+func ParseDiagnostics(parser string, output []byte) ([]Diagnostic, []string) {
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	if parser != config.ParserGo {
+		return nil, lines
+	}
+
+	var diagnostics []Diagnostic
+	var raw []string
+	for _, line := range lines {
+		if match := goErrorPattern.FindStringSubmatch(line); match != nil {
+			lineNum, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			diagnostics = append(diagnostics, Diagnostic{
+				File:    strings.TrimPrefix(match[1], "./"),
+				Line:    lineNum,
+				Column:  column,
+				Message: match[4],
+			})
+			continue
+		}
+
+		// Indented lines continue the previous error (e.g. "have (int)" / "want (string)")
+		if strings.HasPrefix(line, "\t") && len(diagnostics) > 0 {
+			last := &diagnostics[len(diagnostics)-1]
+			last.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		// "# package" headers only group the errors that follow
+		if strings.HasPrefix(line, "# ") || line == "" {
+			continue
+		}
+		raw = append(raw, line)
+	}
+	return diagnostics, raw
+}
@@ -0,0 +1,38 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// Generate runs the rule's generate steps in order, with their output labeled
+// [generate:<rule>] and collected in output, and stops at the first one that fails. name
+// is the container name for rules that build in a container.
+func Generate(ctx context.Context, rule *config.BuildRule, name string, output *OutputBuffer) error {
+	prefix := fmt.Sprintf("[generate:%s] ", rule.Name)
+	for i, step := range rule.Generate {
+		logger.Printf("[build] %s: generating (%d/%d): %s\n", rule.Name, i+1, len(rule.Generate), step)
+
+		cmd, err := Command(ctx, rule, step, name)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = io.MultiWriter(logger.NewPrefixWriter(prefix, logger.Output(), logger.BuildLog), output)
+		cmd.Stderr = io.MultiWriter(logger.NewPrefixWriter(prefix, os.Stderr, logger.BuildLog), output)
+		cmd.WaitDelay = time.Second
+
+		if err := cmd.Run(); err != nil {
+			if len(rule.Generate) == 1 {
+				return fmt.Errorf("generate failed: %w", err)
+			}
+			return fmt.Errorf("generate step %d/%d (%s) failed: %w", i+1, len(rule.Generate), step, err)
+		}
+	}
+	return nil
+}
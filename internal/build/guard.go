@@ -0,0 +1,48 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// guardTimeout is how long a when_cmd may run before it counts as failed, so a hanging
+// guard (e.g. docker info without a responding daemon) doesn't hold up builds
+var guardTimeout = 10 * time.Second
+
+// GuardPasses runs the rule's when_cmd and reports whether it succeeded, i.e. whether the
+// rule should build. A rule without when_cmd always builds. The guard's output is only
+// shown in debug mode; a failed guard is logged as a skipped build.
+func GuardPasses(rule *config.BuildRule) bool {
+	if rule.WhenCmd == "" {
+		return true
+	}
+
+	logger.Printf("[build] Checking when_cmd of %s: %s\n", rule.Name, rule.WhenCmd)
+	ctx, cancel := context.WithTimeout(context.Background(), guardTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", rule.WhenCmd)
+	// Don't wait for children of the shell that keep its output open after it was killed
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", guardTimeout)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			logger.Printf("[build] [when_cmd] %s\n", line)
+		}
+	}
+
+	if err != nil {
+		logger.Warnf("[build] \033[33mSkipping %s: when_cmd %q failed (%v)\033[0m\n", rule.Name, rule.WhenCmd, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+func TestGuardPasses(t *testing.T) {
+	tests := []struct {
+		whenCmd string
+		want    bool
+	}{
+		{"", true},
+		{"true", true},
+		{"echo checking; exit 1", false},
+	}
+	for _, tt := range tests {
+		if got := GuardPasses(&config.BuildRule{Name: "docker", WhenCmd: tt.whenCmd}); got != tt.want {
+			t.Errorf("GuardPasses with when_cmd %q = %v, want %v", tt.whenCmd, got, tt.want)
+		}
+	}
+}
+
+func TestGuardPassesTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { guardTimeout = timeout }(guardTimeout)
+	guardTimeout = 100 * time.Millisecond
+
+	// A hanging guard, whose child keeps the output open after the shell is killed
+	start := time.Now()
+	if GuardPasses(&config.BuildRule{Name: "docker", WhenCmd: "sleep 10 & sleep 10"}) {
+		t.Error("GuardPasses = true for a when_cmd that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GuardPasses took %s, want it to give up after the timeout", elapsed)
+	}
+}
@@ -0,0 +1,135 @@
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// maxPersistedHistory is the number of builds kept in the history file
+const maxPersistedHistory = 500
+
+// HistoryFile appends finished builds to a JSON Lines file that survives restarts
+type HistoryFile struct {
+	mu    sync.Mutex
+	path  string
+	lines int
+}
+
+// OpenHistoryFile prepares the history file at path, creating its directory if needed
+func OpenHistoryFile(path string) (*HistoryFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	records, err := ReadHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistoryFile{path: path, lines: len(records)}, nil
+}
+
+// PersistHistory makes store append finished builds to cfg's history_file if
+// persist_history is set
+func PersistHistory(cfg *config.Config, store *Store) error {
+	if !cfg.PersistHistory {
+		return nil
+	}
+	historyFile, err := OpenHistoryFile(cfg.HistoryFile)
+	if err != nil {
+		return err
+	}
+	store.PersistTo(historyFile)
+	return nil
+}
+
+// Append writes a finished build to the history file, trimming it once it grows past its cap
+func (h *HistoryFile) Append(record BuildRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	h.lines++
+
+	// Trim in batches so the file isn't rewritten on every build
+	if h.lines > maxPersistedHistory*2 {
+		return h.trim()
+	}
+	return nil
+}
+
+// trim rewrites the history file with only the most recent builds
+func (h *HistoryFile) trim() error {
+	records, err := ReadHistory(h.path)
+	if err != nil {
+		return err
+	}
+	if len(records) > maxPersistedHistory {
+		records = records[len(records)-maxPersistedHistory:]
+	}
+
+	var data []byte
+	for _, record := range records {
+		line, _ := json.Marshal(record)
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	tmpPath := h.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmpPath, h.path); err != nil {
+		return fmt.Errorf("failed to replace history file: %w", err)
+	}
+	h.lines = len(records)
+	return nil
+}
+
+// ReadHistory returns the builds recorded in a history file, oldest first.
+// A missing file is an empty history; malformed lines are skipped.
+func ReadHistory(path string) ([]BuildRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var records []BuildRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record BuildRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return records, nil
+}
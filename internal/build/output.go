@@ -0,0 +1,87 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// OutputBuffer collects a command's combined stdout and stderr
+type OutputBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer interface
+func (o *OutputBuffer) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+// Bytes returns the output collected so far
+func (o *OutputBuffer) Bytes() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]byte(nil), o.buf.Bytes()...)
+}
+
+// CheckOutput decides whether a finished build succeeded. Without patterns the exit status
+// (runErr) decides. A matching failure_pattern fails the build regardless of the exit status,
+// and a set success_pattern decides on its own: the build succeeds only if it matches. A
+// successful build must also have produced the rule's output.
+func CheckOutput(rule *config.BuildRule, output []byte, runErr error) error {
+	if rule.FailurePattern != "" {
+		re, err := regexp.Compile(rule.FailurePattern)
+		if err != nil {
+			return fmt.Errorf("invalid failure_pattern: %w", err)
+		}
+		if match := re.Find(output); match != nil {
+			return fmt.Errorf("output matched failure_pattern: %s", match)
+		}
+	}
+
+	if rule.SuccessPattern != "" {
+		re, err := regexp.Compile(rule.SuccessPattern)
+		if err != nil {
+			return fmt.Errorf("invalid success_pattern: %w", err)
+		}
+		if !re.Match(output) {
+			return fmt.Errorf("output did not match success_pattern")
+		}
+		return verifyOutput(rule)
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	return verifyOutput(rule)
+}
+
+// verifyOutput checks that the rule's output exists and isn't empty, so a build that exits 0
+// without writing anything (e.g. a wrong -o path) doesn't restart the backend with a stale binary
+func verifyOutput(rule *config.BuildRule) error {
+	if rule.Output == "" {
+		return nil
+	}
+
+	info, err := os.Stat(rule.Output)
+	if err != nil {
+		return fmt.Errorf("build succeeded but did not produce %s", rule.Output)
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(rule.Output)
+		if err != nil || len(entries) == 0 {
+			return fmt.Errorf("build succeeded but %s is empty", rule.Output)
+		}
+		return nil
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("build succeeded but %s is empty", rule.Output)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package build
+
+import "time"
+
+// Scheduling states of a rule that isn't building. While a rule builds, and once its build
+// finished, it reports the build status instead (building, success or failed).
+const (
+	RuleIdle    = "idle"    // Not built since godevwatch started
+	RuleQueued  = "queued"  // Changed, waiting for the debounce delay
+	RuleBlocked = "blocked" // Waiting for a dependency, a serialized rule or a git operation
+)
+
+// RuleState is a rule's place in the build schedule
+type RuleState struct {
+	Rule       string `json:"rule"`
+	State      string `json:"state"`
+	WaitingFor string `json:"waiting_for,omitempty"` // The rule (or "git") a blocked rule waits for
+	Timestamp  int64  `json:"timestamp"`             // Time of the latest state change
+}
+
+// ruleState is a RuleState together with the result a rule falls back to when it leaves the
+// queue without building
+type ruleState struct {
+	RuleState
+	last string // Status of the latest finished build, or RuleIdle
+}
+
+// SetRules registers the configured rules, in order. New rules start idle, and rules that are
+// no longer configured are dropped.
+func (s *Store) SetRules(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make(map[string]*ruleState, len(names))
+	for _, name := range names {
+		if state, ok := s.rules[name]; ok {
+			rules[name] = state
+		} else {
+			rules[name] = newRuleState(name)
+		}
+	}
+	s.rules = rules
+	s.ruleOrder = append([]string(nil), names...)
+}
+
+// QueueRule marks a rule as waiting to build: queued, or blocked if waitingFor names what it
+// waits for
+func (s *Store) QueueRule(name, waitingFor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := RuleQueued
+	if waitingFor != "" {
+		state = RuleBlocked
+	}
+	s.setRuleState(name, state, waitingFor)
+}
+
+// SettleRule marks a waiting rule that was dropped without building as back at the result of
+// its latest build
+func (s *Store) SettleRule(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state := s.rule(name); state.State == RuleQueued || state.State == RuleBlocked {
+		s.setRuleState(name, state.last, "")
+	}
+}
+
+// RuleStates returns the scheduling state of every rule, configured rules first and in order
+func (s *Store) RuleStates() []RuleState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ruleStates()
+}
+
+// ruleStates implements RuleStates. Must be called with s.mu held.
+func (s *Store) ruleStates() []RuleState {
+	states := make([]RuleState, 0, len(s.rules))
+	for _, name := range s.ruleOrder {
+		if state, ok := s.rules[name]; ok {
+			states = append(states, state.RuleState)
+		}
+	}
+	return states
+}
+
+// trackRule moves a rule along with the status change of one of its builds. A build that
+// finishes while the rule is waiting to build again leaves it waiting. Must be called with
+// s.mu held.
+func (s *Store) trackRule(record BuildRecord) {
+	state := s.rule(record.RuleName)
+	waiting := state.State == RuleQueued || state.State == RuleBlocked
+
+	switch record.Status {
+	case StatusBuilding:
+		s.setRuleState(record.RuleName, StatusBuilding, "")
+	case StatusSuccess, StatusFailed:
+		state.last = record.Status
+		if !waiting {
+			s.setRuleState(record.RuleName, record.Status, "")
+		}
+	case StatusAborted:
+		if !waiting {
+			s.setRuleState(record.RuleName, state.last, "")
+		}
+	}
+}
+
+// rule returns the state of the named rule, registering rules the store hasn't seen yet (such
+// as rules built before SetRules). Must be called with s.mu held.
+func (s *Store) rule(name string) *ruleState {
+	if s.rules == nil {
+		s.rules = make(map[string]*ruleState)
+	}
+	state, ok := s.rules[name]
+	if !ok {
+		state = newRuleState(name)
+		s.rules[name] = state
+		s.ruleOrder = append(s.ruleOrder, name)
+	}
+	return state
+}
+
+// setRuleState changes a rule's state. Must be called with s.mu held.
+func (s *Store) setRuleState(name, state, waitingFor string) {
+	rule := s.rule(name)
+	rule.State = state
+	rule.WaitingFor = waitingFor
+	rule.Timestamp = time.Now().Unix()
+}
+
+func newRuleState(name string) *ruleState {
+	return &ruleState{
+		RuleState: RuleState{Rule: name, State: RuleIdle, Timestamp: time.Now().Unix()},
+		last:      RuleIdle,
+	}
+}
@@ -0,0 +1,92 @@
+package build
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// StatusFS is where a Tracker writes its status files
+type StatusFS interface {
+	// MkdirAll creates a directory along with any missing parents
+	MkdirAll(dir string) error
+	// WriteFile replaces a file's content in one step, so readers never see it half-written
+	WriteFile(path string, data []byte) error
+}
+
+// OSStatusFS writes status files to disk and records them for RemoveStatusFiles. It is
+// what trackers use unless told otherwise.
+type OSStatusFS struct{}
+
+// MkdirAll creates dir on disk
+func (OSStatusFS) MkdirAll(dir string) error {
+	return ensureDir(dir)
+}
+
+// WriteFile atomically writes a file on disk
+func (OSStatusFS) WriteFile(path string, data []byte) error {
+	return writeStatusFile(path, data)
+}
+
+// MemoryStatusFS keeps status files in memory, for trackers whose state only needs to be
+// inspected in process
+type MemoryStatusFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+// NewMemoryStatusFS creates an empty in-memory status filesystem
+func NewMemoryStatusFS() *MemoryStatusFS {
+	return &MemoryStatusFS{
+		files: make(map[string][]byte),
+		dirs:  make(map[string]bool),
+	}
+}
+
+// MkdirAll records dir and its parents
+func (m *MemoryStatusFS) MkdirAll(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for d := filepath.Clean(dir); d != "." && d != string(filepath.Separator); d = filepath.Dir(d) {
+		m.dirs[d] = true
+	}
+	return nil
+}
+
+// WriteFile stores a copy of data at path, whose directory must have been created
+func (m *MemoryStatusFS) WriteFile(path string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if dir := filepath.Dir(path); dir != "." && !m.dirs[dir] {
+		return &fs.PathError{Op: "write", Path: path, Err: fs.ErrNotExist}
+	}
+	m.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+// ReadFile returns the content of a file and whether it exists
+func (m *MemoryStatusFS) ReadFile(path string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[filepath.Clean(path)]
+	return append([]byte(nil), data...), ok
+}
+
+// Files returns the paths of all files, sorted
+func (m *MemoryStatusFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
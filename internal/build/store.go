@@ -0,0 +1,210 @@
+package build
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// Build statuses
+const (
+	StatusBuilding = "building"
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusAborted  = "aborted"
+)
+
+const (
+	// maxHistory is the number of builds kept in memory
+	maxHistory = 100
+	// subscriberBuffer is the number of events buffered per subscriber before events are dropped
+	subscriberBuffer = 16
+)
+
+// BuildRecord describes a single build and its latest status
+type BuildRecord struct {
+	BuildID   string `json:"build_id"`
+	RuleName  string `json:"rule_name"`
+	Status    string `json:"status"`
+	StartedAt int64  `json:"started_at"`
+	Timestamp int64  `json:"timestamp"` // Time of the latest status change
+
+	// TriggeredBy lists the changed files that triggered the build (at most
+	// maxTriggeredBy of them), TriggeredByCount how many there were in total
+	TriggeredBy      []string `json:"triggered_by,omitempty"`
+	TriggeredByCount int      `json:"triggered_by_count,omitempty"`
+
+	// Diagnostics are the errors parsed from a failed build's output (with a rule parser),
+	// RawOutput the output lines the parser didn't recognize
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	RawOutput   []string     `json:"raw_output,omitempty"`
+}
+
+// BuildStatus is a snapshot of the current build state
+type BuildStatus struct {
+	// Building is true while any rule is building
+	Building bool `json:"building"`
+	// CurrentBuild is the most recently updated build, whatever its status
+	CurrentBuild *BuildRecord `json:"current_build,omitempty"`
+	// LastBuild is the most recently finished build
+	LastBuild *BuildRecord `json:"last_build,omitempty"`
+	// Running is the number of builds in progress. Builds of different rules run in parallel
+	// unless serialize_with or depends_on holds them back.
+	Running int `json:"running"`
+	// Rules is the scheduling state of every rule
+	Rules []RuleState `json:"rules,omitempty"`
+}
+
+// BuildEvent is published whenever a build changes status
+type BuildEvent struct {
+	Record BuildRecord
+}
+
+// Store keeps build records in memory and publishes status changes to subscribers
+type Store struct {
+	mu          sync.RWMutex
+	history     []BuildRecord
+	lastUpdated string // Build ID of the most recently updated record
+	subscribers map[chan BuildEvent]bool
+	historyFile *HistoryFile // Optional, receives finished builds
+	rules       map[string]*ruleState
+	ruleOrder   []string // Rule names in config order
+}
+
+// NewStore creates a new build store
+func NewStore() *Store {
+	return &Store{
+		subscribers: make(map[chan BuildEvent]bool),
+	}
+}
+
+// PersistTo appends every finished build to a history file that outlives the process
+func (s *Store) PersistTo(historyFile *HistoryFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.historyFile = historyFile
+}
+
+// CurrentStatus returns the most recently updated build and where each rule is in the build
+// schedule
+func (s *Store) CurrentStatus() BuildStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := BuildStatus{Rules: s.ruleStates()}
+	for i := range s.history {
+		record := s.history[i]
+		if record.BuildID == s.lastUpdated {
+			status.CurrentBuild = &record
+		}
+		if record.Status == StatusBuilding {
+			status.Building = true
+			status.Running++
+		} else if status.LastBuild == nil || record.Timestamp >= status.LastBuild.Timestamp {
+			status.LastBuild = &record
+		}
+	}
+	return status
+}
+
+// FailedRules returns the rules whose latest finished build failed. Aborted builds don't count.
+func (s *Store) FailedRules() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := make(map[string]BuildRecord)
+	for _, record := range s.history {
+		if record.Status != StatusSuccess && record.Status != StatusFailed {
+			continue
+		}
+		if prev, ok := latest[record.RuleName]; !ok || record.Timestamp >= prev.Timestamp {
+			latest[record.RuleName] = record
+		}
+	}
+
+	failed := []string{}
+	for rule, record := range latest {
+		if record.Status == StatusFailed {
+			failed = append(failed, rule)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// History returns all known builds, oldest first
+func (s *Store) History() []BuildRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make([]BuildRecord, len(s.history))
+	copy(history, s.history)
+	return history
+}
+
+// Subscribe returns a channel that receives an event for every build status change.
+// Events are dropped for subscribers that don't keep up.
+func (s *Store) Subscribe() <-chan BuildEvent {
+	ch := make(chan BuildEvent, subscriberBuffer)
+
+	s.mu.Lock()
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe stops delivering events to a channel returned by Subscribe
+func (s *Store) Unsubscribe(ch <-chan BuildEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscribers {
+		if sub == ch {
+			delete(s.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// record inserts or updates a build record and notifies subscribers
+func (s *Store) record(record BuildRecord) {
+	s.mu.Lock()
+
+	s.lastUpdated = record.BuildID
+	s.trackRule(record)
+
+	updated := false
+	for i := range s.history {
+		if s.history[i].BuildID == record.BuildID {
+			s.history[i] = record
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		s.history = append(s.history, record)
+		if len(s.history) > maxHistory {
+			s.history = s.history[len(s.history)-maxHistory:]
+		}
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub <- BuildEvent{Record: record}:
+		default:
+			// Subscriber not keeping up, drop the event
+		}
+	}
+	historyFile := s.historyFile
+	s.mu.Unlock()
+
+	// Write the history file outside the lock, so a slow disk doesn't hold up status readers
+	if historyFile != nil && record.Status != StatusBuilding {
+		if err := historyFile.Append(record); err != nil {
+			logger.Warnf("[build] Warning: failed to persist build history: %v\n", err)
+		}
+	}
+}
@@ -4,29 +4,67 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/kyco/godevwatch/internal/logger"
 )
 
-// Tracker manages build status files
+// Tracker manages build status files and reports status changes to a Store. It is safe
+// for concurrent use; only the first of Complete, Fail and Abort takes effect.
 type Tracker struct {
+	mu             sync.Mutex
+	finished       bool // Complete, Fail or Abort has run
+	store          *Store
+	fs             StatusFS
 	statusDir      string
+	ruleName       string
 	buildID        string
 	startTimestamp int64
-	debugMode      bool
+	preserve       bool // Status files are kept after shutdown (keep_status)
+	diagnostics    []Diagnostic
+	rawOutput      []string
+	triggeredBy    []string
+	triggerCount   int
 }
 
-// NewTracker creates a new build tracker
-func NewTracker(statusDir string, debugMode bool) *Tracker {
+// NewTracker creates a new build tracker for a rule. store may be nil. preserve tells the
+// tracker that its status files are kept after shutdown.
+func NewTracker(store *Store, statusDir string, ruleName string, preserve bool) *Tracker {
 	return &Tracker{
+		store:     store,
+		fs:        OSStatusFS{},
 		statusDir: statusDir,
-		debugMode: debugMode,
+		ruleName:  ruleName,
+		preserve:  preserve,
 	}
 }
 
+// SetFS makes the tracker write its status files to fs instead of the OS filesystem
+func (t *Tracker) SetFS(fs StatusFS) {
+	t.fs = fs
+}
+
+// publish reports the build's new status to the store
+func (t *Tracker) publish(status string, timestamp int64) {
+	if t.store == nil {
+		return
+	}
+	t.store.record(BuildRecord{
+		BuildID:     t.buildID,
+		RuleName:    t.ruleName,
+		Status:      status,
+		StartedAt:   t.startTimestamp,
+		Timestamp:   timestamp,
+		Diagnostics: t.diagnostics,
+		RawOutput:   t.rawOutput,
+
+		TriggeredBy:      t.triggeredBy,
+		TriggeredByCount: t.triggerCount,
+	})
+}
+
 // generateBuildID creates a unique build ID string
 func (t *Tracker) generateBuildID() string {
 	// Generate 4 random bytes and encode as hex for a unique ID (8 characters)
@@ -37,8 +75,11 @@ func (t *Tracker) generateBuildID() string {
 
 // Start marks the beginning of a build
 func (t *Tracker) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	// Ensure status directory exists
-	if err := os.MkdirAll(t.statusDir, 0755); err != nil {
+	if err := t.fs.MkdirAll(t.statusDir); err != nil {
 		return fmt.Errorf("failed to create status directory: %w", err)
 	}
 
@@ -47,83 +88,174 @@ func (t *Tracker) Start() error {
 	t.startTimestamp = time.Now().Unix()
 	logger.Printf("[build] Build ID: %s (start timestamp: %d)\n", t.buildID, t.startTimestamp)
 
+	// Create building marker file with actual start timestamp, before current-build-id points at it
+	buildingMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-%s", t.startTimestamp, t.buildID, StatusBuilding))
+	if err := t.fs.WriteFile(buildingMarkerPath, []byte{}); err != nil {
+		return fmt.Errorf("failed to write building marker: %w", err)
+	}
+	logger.Printf("[build] Created %s\n", buildingMarkerPath)
+
 	// Write current build ID
 	currentBuildIDPath := filepath.Join(t.statusDir, "current-build-id")
-	if err := os.WriteFile(currentBuildIDPath, []byte(t.buildID), 0644); err != nil {
+	if err := t.fs.WriteFile(currentBuildIDPath, []byte(t.buildID)); err != nil {
 		return fmt.Errorf("failed to write current-build-id: %w", err)
 	}
 	logger.Printf("[build] Created %s\n", filepath.Join(t.statusDir, "current-build-id"))
 
-	// Create building marker file with actual start timestamp
-	buildingMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-building", t.startTimestamp, t.buildID))
-	if err := os.WriteFile(buildingMarkerPath, []byte{}, 0644); err != nil {
-		return fmt.Errorf("failed to write building marker: %w", err)
+	if err := t.writeCurrentStatus(StatusBuilding, t.startTimestamp); err != nil {
+		return err
 	}
-	logger.Printf("[build] Created %s\n", buildingMarkerPath)
 
+	t.publish(StatusBuilding, t.startTimestamp)
 	return nil
 }
 
 // Complete marks the successful completion of a build
 func (t *Tracker) Complete() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
 	// Capture completion timestamp at the exact moment of success
 	completionTimestamp := time.Now().Unix()
-	successMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-success", completionTimestamp, t.buildID))
-	if err := os.WriteFile(successMarkerPath, []byte{}, 0644); err != nil {
+	successMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-%s", completionTimestamp, t.buildID, StatusSuccess))
+	if err := t.fs.WriteFile(successMarkerPath, []byte{}); err != nil {
 		return fmt.Errorf("failed to write success marker: %w", err)
 	}
 	logger.Printf("[build] Created %s (completion timestamp: %d)\n", successMarkerPath, completionTimestamp)
 
 	// Write last-success-build-id
 	lastSuccessPath := filepath.Join(t.statusDir, "last-success-build-id")
-	if err := os.WriteFile(lastSuccessPath, []byte(t.buildID), 0644); err != nil {
+	if err := t.fs.WriteFile(lastSuccessPath, []byte(t.buildID)); err != nil {
 		return fmt.Errorf("failed to write last-success-build-id: %w", err)
 	}
 	logger.Printf("[build] Created %s\n", lastSuccessPath)
 
 	// Keep all build ID status files for audit purposes
-	logger.Printf("[build] Preserving all build status files for audit\n")
+	if t.preserve {
+		logger.Printf("[build] Preserving all build status files for audit\n")
+	}
 
+	if err := t.writeCurrentStatus(StatusSuccess, completionTimestamp); err != nil {
+		return err
+	}
+
+	t.publish(StatusSuccess, completionTimestamp)
 	return nil
 }
 
+// maxTriggeredBy caps how many triggering files are kept in a build record
+const maxTriggeredBy = 20
+
+// SetTriggeredBy records the changed files that triggered the build. Call it before Start.
+func (t *Tracker) SetTriggeredBy(files []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.triggerCount = len(files)
+	if len(files) > maxTriggeredBy {
+		files = files[:maxTriggeredBy]
+	}
+	t.triggeredBy = files
+}
+
+// Diagnose parses a failed build's output with the rule's parser so the errors are reported
+// with the failure. It does nothing without a parser.
+func (t *Tracker) Diagnose(parser string, output []byte) {
+	if parser == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return
+	}
+	t.diagnostics, t.rawOutput = ParseDiagnostics(parser, output)
+}
+
 // Fail marks a build as failed
 func (t *Tracker) Fail() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
 	logger.Printf("[build] Marking build as failed\n")
 
 	// Capture failure timestamp at the exact moment of failure
 	failureTimestamp := time.Now().Unix()
-	failedMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-failed", failureTimestamp, t.buildID))
-	if err := os.WriteFile(failedMarkerPath, []byte{}, 0644); err != nil {
+	failedMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-%s", failureTimestamp, t.buildID, StatusFailed))
+	if err := t.fs.WriteFile(failedMarkerPath, []byte{}); err != nil {
 		return fmt.Errorf("failed to write failed marker: %w", err)
 	}
 	logger.Printf("[build] Created %s (failure timestamp: %d)\n", failedMarkerPath, failureTimestamp)
 
 	// Note: We keep the building marker file for audit purposes
-	fmt.Printf("[build] Preserving building marker for audit\n")
+	if t.preserve {
+		logger.Printf("[build] Preserving building marker for audit\n")
+	}
 
+	if err := t.writeCurrentStatus(StatusFailed, failureTimestamp); err != nil {
+		return err
+	}
+
+	t.publish(StatusFailed, failureTimestamp)
 	return nil
 }
 
 // Abort marks a build as aborted
 func (t *Tracker) Abort() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
 	logger.Printf("[build] Marking build as aborted\n")
 
 	// Capture abort timestamp at the exact moment of abortion
 	abortTimestamp := time.Now().Unix()
-	abortedMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-aborted", abortTimestamp, t.buildID))
-	if err := os.WriteFile(abortedMarkerPath, []byte{}, 0644); err != nil {
+	abortedMarkerPath := filepath.Join(t.statusDir, fmt.Sprintf("%d-%s-%s", abortTimestamp, t.buildID, StatusAborted))
+	if err := t.fs.WriteFile(abortedMarkerPath, []byte{}); err != nil {
 		return fmt.Errorf("failed to write aborted marker: %w", err)
 	}
 	logger.Printf("[build] Created %s (abort timestamp: %d)\n", abortedMarkerPath, abortTimestamp)
 
 	// Note: We keep the building marker file for audit purposes
-	fmt.Printf("[build] Preserving building marker for audit\n")
+	if t.preserve {
+		logger.Printf("[build] Preserving building marker for audit\n")
+	}
+
+	if err := t.writeCurrentStatus(StatusAborted, abortTimestamp); err != nil {
+		return err
+	}
 
+	t.publish(StatusAborted, abortTimestamp)
+	return nil
+}
+
+// writeCurrentStatus replaces the current-status file, which holds the latest build's
+// "<timestamp>-<build id>-<status>" in a single atomic write. Readers should prefer it over
+// combining current-build-id with the marker files, which are written one after another.
+func (t *Tracker) writeCurrentStatus(status string, timestamp int64) error {
+	path := filepath.Join(t.statusDir, "current-status")
+	content := fmt.Sprintf("%d-%s-%s\n", timestamp, t.buildID, status)
+	if err := t.fs.WriteFile(path, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write current-status: %w", err)
+	}
 	return nil
 }
 
 // GetBuildID returns the current build ID
 func (t *Tracker) GetBuildID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.buildID
 }
@@ -0,0 +1,182 @@
+package build
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestTracker returns a tracker for rule that writes to an in-memory status directory
+func newTestTracker(t *testing.T, store *Store, rule string) (*Tracker, *MemoryStatusFS) {
+	t.Helper()
+	fs := NewMemoryStatusFS()
+	tracker := NewTracker(store, "status", rule, false)
+	tracker.SetFS(fs)
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return tracker, fs
+}
+
+// readStatusFile returns the content of a file in the status directory
+func readStatusFile(t *testing.T, fs *MemoryStatusFS, name string) string {
+	t.Helper()
+	data, ok := fs.ReadFile(filepath.Join("status", name))
+	if !ok {
+		t.Fatalf("%s was not written (files: %v)", name, fs.Files())
+	}
+	return string(data)
+}
+
+// hasMarker reports whether a "<timestamp>-<build id>-<status>" marker file was written
+func hasMarker(fs *MemoryStatusFS, buildID, status string) bool {
+	for _, path := range fs.Files() {
+		if strings.HasSuffix(path, "-"+buildID+"-"+status) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCurrentStatus checks that current-status names the build with status
+func checkCurrentStatus(t *testing.T, fs *MemoryStatusFS, buildID, status string) {
+	t.Helper()
+	current := strings.TrimSpace(readStatusFile(t, fs, "current-status"))
+	if !strings.HasSuffix(current, "-"+buildID+"-"+status) {
+		t.Errorf("current-status = %q, want <timestamp>-%s-%s", current, buildID, status)
+	}
+}
+
+func TestTrackerStart(t *testing.T) {
+	store := NewStore()
+	tracker, fs := newTestTracker(t, store, "go-build")
+	id := tracker.GetBuildID()
+
+	if got := readStatusFile(t, fs, "current-build-id"); got != id {
+		t.Errorf("current-build-id = %q, want %q", got, id)
+	}
+	if !hasMarker(fs, id, StatusBuilding) {
+		t.Errorf("no building marker for %s in %v", id, fs.Files())
+	}
+	checkCurrentStatus(t, fs, id, StatusBuilding)
+
+	status := store.CurrentStatus()
+	if !status.Building || status.Running != 1 {
+		t.Errorf("store reports building=%v running=%d, want a running build", status.Building, status.Running)
+	}
+	if status.CurrentBuild == nil || status.CurrentBuild.BuildID != id {
+		t.Errorf("current build = %+v, want %s", status.CurrentBuild, id)
+	}
+}
+
+func TestTrackerComplete(t *testing.T) {
+	store := NewStore()
+	tracker, fs := newTestTracker(t, store, "go-build")
+	id := tracker.GetBuildID()
+
+	if err := tracker.Complete(); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if !hasMarker(fs, id, StatusSuccess) {
+		t.Errorf("no success marker for %s in %v", id, fs.Files())
+	}
+	if got := readStatusFile(t, fs, "last-success-build-id"); got != id {
+		t.Errorf("last-success-build-id = %q, want %q", got, id)
+	}
+	checkCurrentStatus(t, fs, id, StatusSuccess)
+
+	status := store.CurrentStatus()
+	if status.Building || status.LastBuild == nil || status.LastBuild.Status != StatusSuccess {
+		t.Errorf("store reports building=%v last build %+v, want a successful build", status.Building, status.LastBuild)
+	}
+}
+
+func TestTrackerFail(t *testing.T) {
+	store := NewStore()
+	tracker, fs := newTestTracker(t, store, "go-build")
+	id := tracker.GetBuildID()
+
+	tracker.Diagnose("go", []byte("main.go:3:2: undefined: foo\n"))
+	if err := tracker.Fail(); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	if !hasMarker(fs, id, StatusFailed) {
+		t.Errorf("no failed marker for %s in %v", id, fs.Files())
+	}
+	if _, ok := fs.ReadFile(filepath.Join("status", "last-success-build-id")); ok {
+		t.Error("a failed build wrote last-success-build-id")
+	}
+	checkCurrentStatus(t, fs, id, StatusFailed)
+
+	if failed := store.FailedRules(); len(failed) != 1 || failed[0] != "go-build" {
+		t.Errorf("failed rules = %v, want [go-build]", failed)
+	}
+	last := store.CurrentStatus().LastBuild
+	if last == nil || len(last.Diagnostics) != 1 || last.Diagnostics[0].File != "main.go" {
+		t.Errorf("last build = %+v, want one diagnostic in main.go", last)
+	}
+}
+
+func TestTrackerAbort(t *testing.T) {
+	store := NewStore()
+	tracker, fs := newTestTracker(t, store, "go-build")
+	id := tracker.GetBuildID()
+
+	if err := tracker.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if !hasMarker(fs, id, StatusAborted) {
+		t.Errorf("no aborted marker for %s in %v", id, fs.Files())
+	}
+	checkCurrentStatus(t, fs, id, StatusAborted)
+
+	// An aborted build is neither a failure nor running, and leaves the rule idle
+	if failed := store.FailedRules(); len(failed) != 0 {
+		t.Errorf("failed rules = %v, want none", failed)
+	}
+	status := store.CurrentStatus()
+	if status.Building {
+		t.Error("store still reports a running build")
+	}
+	if len(status.Rules) != 1 || status.Rules[0].State != RuleIdle {
+		t.Errorf("rules = %+v, want go-build idle", status.Rules)
+	}
+}
+
+func TestTrackerFailAfterAbort(t *testing.T) {
+	store := NewStore()
+	tracker, fs := newTestTracker(t, store, "go-build")
+	id := tracker.GetBuildID()
+
+	// A build killed by an abort may still report its failure afterwards
+	if err := tracker.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	tracker.Diagnose("go", []byte("main.go:3:2: undefined: foo\n"))
+	if err := tracker.Fail(); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	if hasMarker(fs, id, StatusFailed) {
+		t.Errorf("failed marker written after the abort: %v", fs.Files())
+	}
+	checkCurrentStatus(t, fs, id, StatusAborted)
+	if failed := store.FailedRules(); len(failed) != 0 {
+		t.Errorf("failed rules = %v, want none", failed)
+	}
+}
+
+func TestTrackerWithoutStore(t *testing.T) {
+	tracker, fs := newTestTracker(t, nil, "go-build")
+	if err := tracker.Complete(); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	checkCurrentStatus(t, fs, tracker.GetBuildID(), StatusSuccess)
+}
+
+func TestMemoryStatusFSMissingDir(t *testing.T) {
+	fs := NewMemoryStatusFS()
+	if err := fs.WriteFile(filepath.Join("status", "current-status"), nil); err == nil {
+		t.Error("WriteFile succeeded without the directory being created")
+	}
+}
@@ -1,9 +1,19 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/kyco/godevwatch/internal/logger"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,80 +21,1417 @@ type BuildRule struct {
 	Name    string   `yaml:"name"`
 	Watch   []string `yaml:"watch"`
 	Ignore  []string `yaml:"ignore,omitempty"`
-	Command string   `yaml:"command"`
+	Command Commands `yaml:"command"` // A single command or a list of steps
+
+	// Generate runs before Command (e.g. "go generate ./..." or "sqlc generate"); if it fails,
+	// Command doesn't run
+	Generate Commands `yaml:"generate,omitempty"`
+	// GenerateOutputs are patterns for the files Generate writes, whose changes don't
+	// trigger this rule
+	GenerateOutputs []string `yaml:"generate_outputs,omitempty"`
+
+	// Files lists exact paths (no globs) whose changes trigger the rule
+	Files []string `yaml:"files,omitempty"`
+
+	// WhenCmd is a guard command run before each build; if it exits non-zero the build is
+	// skipped (not failed), e.g. "docker info" for rules that need docker
+	WhenCmd string `yaml:"when_cmd,omitempty"`
+
+	// DependsOn names rules that must finish before this rule runs
+	DependsOn []string `yaml:"depends_on,omitempty"`
+
+	// SerializeWith names rules that never build at the same time as this one (in either
+	// direction): a triggered build waits until they have finished
+	SerializeWith []string `yaml:"serialize_with,omitempty"`
+
+	// Cases run a different command depending on which files changed. The first case
+	// (in order) whose pattern matches any changed file wins; otherwise Command runs.
+	Cases []BuildCase `yaml:"cases,omitempty"`
+
+	// SuccessPattern and FailurePattern are regular expressions matched against the
+	// command's output to decide whether the build succeeded, overriding the exit code
+	SuccessPattern string `yaml:"success_pattern,omitempty"`
+	FailurePattern string `yaml:"failure_pattern,omitempty"`
+
+	// MaxFailureStreak pauses the rule after this many consecutive failures (0 = never pause)
+	MaxFailureStreak int `yaml:"max_failure_streak,omitempty"`
+
+	// Retries re-runs a failed command up to this many times, RetryDelay apart (default 1s),
+	// before the build counts as failed. Aborted builds are never retried, and timed out
+	// initial builds only with RetryOnTimeout.
+	Retries        int           `yaml:"retries,omitempty"`
+	RetryDelay     time.Duration `yaml:"retry_delay,omitempty"`
+	RetryOnTimeout bool          `yaml:"retry_on_timeout,omitempty"`
+
+	// Parser turns a failed build's output into structured errors for /__build-status and
+	// the browser ("go" parses go build and go vet errors)
+	Parser string `yaml:"parser,omitempty"`
+
+	// Events lists the file operations that trigger the rule: write, create, remove, rename
+	// and chmod (defaults to write and create)
+	Events []string `yaml:"events,omitempty"`
+
+	// Initial set to false leaves the rule out of the initial build on startup; it only runs
+	// on changes. InitialOnly runs the rule on startup but never on changes.
+	Initial     *bool `yaml:"initial,omitempty"`
+	InitialOnly bool  `yaml:"initial_only,omitempty"`
+
+	// Interactive connects the command to the terminal's stdin so it can prompt. Other
+	// commands get an empty stdin.
+	Interactive bool `yaml:"interactive,omitempty"`
+
+	// Container runs the command inside a docker container instead of on the host
+	Container *Container `yaml:"container,omitempty"`
+
+	// Output is the file or directory (trailing slash) the command writes. It is never
+	// watched, so the build can't trigger itself. "-o <path>" in the command is detected
+	// automatically. A build that succeeds without producing a non-empty Output fails.
+	Output string `yaml:"output,omitempty"`
+}
+
+// RunsInitially reports whether the rule is part of the initial build on startup
+func (r *BuildRule) RunsInitially() bool {
+	return r.Initial == nil || *r.Initial
+}
+
+// OutputPaths returns the paths the rule's commands write to: Output and any "-o <path>"
+// or "--output <path>" argument of Command and its cases
+func (r *BuildRule) OutputPaths() []string {
+	var paths []string
+	if r.Output != "" {
+		paths = append(paths, r.Output)
+	}
+
+	commands := append([]string(nil), r.Command...)
+	for _, c := range r.Cases {
+		commands = append(commands, c.Command...)
+	}
+	for _, command := range commands {
+		args := strings.Fields(command)
+		for i, arg := range args {
+			switch {
+			case (arg == "-o" || arg == "--output") && i+1 < len(args):
+				paths = append(paths, strings.Trim(args[i+1], `"'`))
+			case strings.HasPrefix(arg, "-o="), strings.HasPrefix(arg, "--output="):
+				paths = append(paths, strings.Trim(arg[strings.Index(arg, "=")+1:], `"'`))
+			}
+		}
+	}
+	return paths
+}
+
+// Container describes the docker container a rule's command runs in. The project
+// directory is mounted at Workdir.
+type Container struct {
+	Image   string   `yaml:"image"`
+	Volumes []string `yaml:"volumes,omitempty"` // Extra "host:container" mounts
+	Workdir string   `yaml:"workdir,omitempty"` // Defaults to /src
+}
+
+// File events a rule can be triggered by
+const (
+	EventWrite  = "write"
+	EventCreate = "create"
+	EventRemove = "remove"
+	EventRename = "rename"
+	EventChmod  = "chmod"
+)
+
+// Modes
+const (
+	// ModeProxy runs the proxy, the backend and the file watcher
+	ModeProxy = "proxy"
+	// ModeWatch only runs the file watcher and build rules, without proxy or backend
+	ModeWatch = "watch"
+)
+
+// Log levels
+const (
+	// LogLevelDebug logs everything, like --debug
+	LogLevelDebug = "debug"
+	// LogLevelInfo logs proxy and backend messages and build results (the default)
+	LogLevelInfo = "info"
+	// LogLevelError only logs errors and warnings, plus build and backend output (--quiet)
+	LogLevelError = "error"
+	// LogLevelSilent only logs errors and warnings (--silent)
+	LogLevelSilent = "silent"
+)
+
+// Run modes
+const (
+	// RunModeBuild runs the build rules on change and restarts run_cmd after a successful build
+	RunModeBuild = "build"
+	// RunModeRerun skips the build rules and restarts run_cmd directly on change (e.g. "go run .")
+	RunModeRerun = "rerun"
+)
+
+// Parsers for build output
+const (
+	// ParserGo understands the "file:line:col: message" errors of go build and go vet
+	ParserGo = "go"
+)
+
+// Backend is a server the proxy routes requests to by path prefix
+type Backend struct {
+	Name       string `yaml:"name"`
+	PathPrefix string `yaml:"path_prefix"`
+	Port       int    `yaml:"port"`
+	URL        string `yaml:"url"` // Defaults to http://<backend_host>:<port>
+}
+
+// Workspace is a service in its own directory with its own godevwatch.yaml (rules, ports
+// and run command). The proxy routes requests for Host, or else below PathPrefix, to it.
+type Workspace struct {
+	Name       string `yaml:"name"` // Defaults to the directory's name
+	Dir        string `yaml:"dir"`
+	Config     string `yaml:"config"`      // Defaults to godevwatch.yaml in Dir
+	PathPrefix string `yaml:"path_prefix"` // Defaults to /<name>/ when Host is empty
+	Host       string `yaml:"host"`
+}
+
+// UnmarshalYAML also accepts a plain directory ("./svc-a") as a workspace
+func (w *Workspace) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		w.Dir = node.Value
+		return nil
+	}
+	type plain Workspace
+	return node.Decode((*plain)(w))
+}
+
+// RuleDefaults are merged into every build rule. Ignore is appended to each rule's own
+// list; the other fields only apply to rules that leave them unset.
+type RuleDefaults struct {
+	Ignore           []string `yaml:"ignore,omitempty"`
+	Watch            []string `yaml:"watch,omitempty"` // Only for rules without watch and files
+	Command          Commands `yaml:"command,omitempty"`
+	SuccessPattern   string   `yaml:"success_pattern,omitempty"`
+	FailurePattern   string   `yaml:"failure_pattern,omitempty"`
+	MaxFailureStreak int      `yaml:"max_failure_streak,omitempty"`
+}
+
+// apply merges the defaults into rule
+func (d *RuleDefaults) apply(rule *BuildRule) {
+	rule.Ignore = append(rule.Ignore, d.Ignore...)
+	if len(rule.Watch) == 0 && len(rule.Files) == 0 {
+		rule.Watch = d.Watch
+	}
+	if len(rule.Command) == 0 {
+		rule.Command = d.Command
+	}
+	if rule.SuccessPattern == "" {
+		rule.SuccessPattern = d.SuccessPattern
+	}
+	if rule.FailurePattern == "" {
+		rule.FailurePattern = d.FailurePattern
+	}
+	if rule.MaxFailureStreak == 0 {
+		rule.MaxFailureStreak = d.MaxFailureStreak
+	}
+}
+
+// BuildCase overrides a rule's command when a changed file matches When
+type BuildCase struct {
+	When    string   `yaml:"when"`
+	Command Commands `yaml:"command"`
+}
+
+// Commands is a rule's command: one shell command, or a list of steps run one after another
+// that stops at the first failing step. In YAML it is either a string or a list of strings.
+type Commands []string
+
+// UnmarshalYAML accepts a single command as well as a list of steps
+func (c *Commands) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = nil
+		if node.ShortTag() != "!!null" && node.Value != "" {
+			*c = Commands{node.Value}
+		}
+		return nil
+	}
+	var steps []string
+	if err := node.Decode(&steps); err != nil {
+		return err
+	}
+	*c = steps
+	return nil
+}
+
+// MarshalYAML writes a single command as a plain string
+func (c Commands) MarshalYAML() (any, error) {
+	if len(c) == 1 {
+		return c[0], nil
+	}
+	return []string(c), nil
+}
+
+// MarshalJSON writes a single command as a plain string
+func (c Commands) MarshalJSON() ([]byte, error) {
+	if len(c) == 1 {
+		return json.Marshal(c[0])
+	}
+	return json.Marshal([]string(c))
 }
 
+// String returns the steps joined with " && ", for logs
+func (c Commands) String() string {
+	return strings.Join(c, " && ")
+}
+
+// DefaultTempFilePatterns are the editor temp files skipped unless temp_file_patterns is set
+var DefaultTempFilePatterns = []string{
+	".#*", "#*#", "*~", // emacs lock and auto-save files, backups
+	"*.swp", "*.swo", "*.swx", "4913", // vim swap files and its write test file
+	"*.tmp", "*.tmp.*", // atomic saves
+	"*___jb_tmp___", "*___jb_old___", // JetBrains safe write
+	".DS_Store",
+}
+
+// InternalEndpoints are the names of godevwatch's own endpoints under internal_prefix. The
+// proxy only registers endpoints named here, so local_routes can't shadow a forgotten one.
+var InternalEndpoints = []string{"health", "ready", "build-status", "reload", "workspaces"}
+
+// LocalRouteBuiltins are the handlers a local_routes entry can name with "builtin:"
+var LocalRouteBuiltins = []string{"no-content", "not-found", "build-status"}
+
 type Config struct {
+	Mode           string      `yaml:"mode"`
 	ProxyPort      int         `yaml:"proxy_port"`
 	BackendPort    int         `yaml:"backend_port"`
+	Backends       []Backend   `yaml:"backends"`
+	Workspaces     []Workspace `yaml:"workspaces"` // Services run with their own config behind this proxy
 	BuildStatusDir string      `yaml:"build_status_dir"`
 	BuildRules     []BuildRule `yaml:"build_rules"`
+	Ignore         []string    `yaml:"ignore"` // Applies to every rule, in addition to its own ignores
 	RunCmd         string      `yaml:"run_cmd"`
-	DebugMode      bool        // Set via --debug flag, not from YAML
+	RunMode        string      `yaml:"run_mode"`
+	InternalPrefix string      `yaml:"internal_prefix"`
+	SetupCmds      []string    `yaml:"setup_cmds"`
+
+	// OnShutdown is a command run on shutdown after the backend is stopped, to tear down
+	// what setup_cmds started. It is killed after OnShutdownTimeout (default 30s).
+	OnShutdown        string        `yaml:"on_shutdown"`
+	OnShutdownTimeout time.Duration `yaml:"on_shutdown_timeout"`
+
+	// LocalRoutes maps request paths to files (or one of LocalRouteBuiltins, prefixed with
+	// "builtin:") that godevwatch serves itself instead of proxying them. A path ending in
+	// "/*" matches everything below it, and a directory serves the files inside it.
+	LocalRoutes map[string]string `yaml:"local_routes"`
+
+	// TempFilePatterns are file name patterns of editor temp files (swap files, backups,
+	// atomic-save files) whose changes are never reported. nil uses DefaultTempFilePatterns.
+	TempFilePatterns []string `yaml:"temp_file_patterns"`
+
+	// BackendHost is the host backends without a url listen on (default localhost). Set it
+	// to an address such as ::1 or [::1] when the backend only listens there.
+	BackendHost string `yaml:"backend_host"`
+
+	// BackendPortPattern is a regular expression matched against the backend's output; its
+	// first group is the port the backend listens on, which then replaces backend_port for
+	// the first backend. The backend counts as starting until a line matches, and after
+	// BackendPortTimeout (default 10s) backend_port is used instead.
+	BackendPortPattern string        `yaml:"backend_port_pattern"`
+	BackendPortTimeout time.Duration `yaml:"backend_port_timeout"`
+
+	// BindAddress is the interface the proxy listens on (default 127.0.0.1). Use 0.0.0.0
+	// to reach the proxy from other devices on the network.
+	BindAddress string `yaml:"bind_address"`
+
+	// BackendURL points the proxy at a backend that isn't plain http on localhost, e.g.
+	// https://localhost:8443. BackendInsecureSkipVerify accepts self-signed certificates.
+	BackendURL                string `yaml:"backend_url"`
+	BackendInsecureSkipVerify bool   `yaml:"backend_insecure_skip_verify"`
+
+	// BackendTimeout answers proxied requests with 504 when the backend takes longer to
+	// start responding (0 = wait forever). Streaming responses only need to start in time.
+	BackendTimeout time.Duration `yaml:"backend_timeout"`
+
+	// MaxRequestBody rejects proxied requests with larger bodies (in bytes) with 413 (0 = unlimited)
+	MaxRequestBody int64 `yaml:"max_request_body"`
+
+	// FlushInterval is how often proxied response bodies are flushed to the client while
+	// streaming (negative flushes after every write). SSE and chunked responses always
+	// flush immediately.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+
+	// Defaults are merged into every build rule
+	Defaults RuleDefaults `yaml:"defaults"`
+
+	// Reload enables browser auto-reload (defaults to true). Disable it for API-only backends.
+	Reload *bool `yaml:"reload"`
+
+	// HoldRequestsDuringRestart makes proxied requests wait (up to HoldTimeout) for the
+	// backend to come back after a successful build instead of showing the down page
+	HoldRequestsDuringRestart bool          `yaml:"hold_requests_during_restart"`
+	HoldTimeout               time.Duration `yaml:"hold_timeout"`
+
+	// WarmupPath is requested from the backend each time it comes up, before browsers are
+	// reloaded, so slow first requests (template compilation, connection pools) are out of
+	// the way. WarmupTimeout bounds the request (default 5s).
+	WarmupPath    string        `yaml:"warmup_path"`
+	WarmupTimeout time.Duration `yaml:"warmup_timeout"`
+
+	// OpenBrowser opens the proxy in the default browser once it is listening
+	OpenBrowser bool `yaml:"open_browser"`
+
+	// OnFirstReady is a command run once, the first time the backend is up after startup
+	// (e.g. to open the browser). Failures are logged and ignored.
+	OnFirstReady string `yaml:"on_first_ready"`
+
+	// OnBackendUp and OnBackendDown are commands run in the background each time a backend
+	// comes up or goes down, with GODEVWATCH_BACKEND_STATUS ("up" or "down") and
+	// GODEVWATCH_BACKEND (the backend's name) set. Failures are logged and ignored.
+	OnBackendUp   string `yaml:"on_backend_up"`
+	OnBackendDown string `yaml:"on_backend_down"`
+
+	// OnSuccess and OnFailure are commands run in the background after each build triggered
+	// by a change, with GODEVWATCH_RULE (the rule's name) set, and GODEVWATCH_ERROR for
+	// failures. Failures of the hooks themselves are logged and ignored.
+	OnSuccess string `yaml:"on_success"`
+	OnFailure string `yaml:"on_failure"`
+
+	// StartupHold holds proxied requests for up to this long after startup while the first
+	// build runs and the backend starts, instead of showing the down page (0 disables)
+	StartupHold time.Duration `yaml:"startup_hold"`
+
+	// IdleTimeout stops the backend after this long without proxied requests; the next
+	// request starts it again (0 disables)
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// AdaptiveDebounce lengthens a rule's debounce delay while its builds keep getting
+	// aborted by newer changes and shortens it again once builds complete, staying within
+	// DebounceMin (default 100ms) and DebounceMax (default 1s)
+	AdaptiveDebounce bool          `yaml:"adaptive_debounce"`
+	DebounceMin      time.Duration `yaml:"debounce_min"`
+	DebounceMax      time.Duration `yaml:"debounce_max"`
+
+	// RestartDebounce waits for builds to settle before restarting the backend, so a burst
+	// of successful builds results in a single restart
+	RestartDebounce time.Duration `yaml:"restart_debounce"`
+
+	// PauseOnGit holds back builds while GitLockFile exists (i.e. during a checkout, rebase or merge)
+	PauseOnGit  bool   `yaml:"pause_on_git"`
+	GitLockFile string `yaml:"git_lock_file"`
+
+	// Buffering of reload events for each connected browser client
+	ReloadBufferSize int    `yaml:"reload_buffer_size"`
+	ReloadDropPolicy string `yaml:"reload_drop_policy"`
+
+	// MaxReloadClients caps the concurrently connected reload clients per backend; further
+	// clients get 503 (default 100)
+	MaxReloadClients int `yaml:"max_reload_clients"`
+
+	// BuildingOverlay injects a small "Rebuilding…" banner into the backend's HTML pages that
+	// shows while a rebuild runs and hides once the new backend is up (needs reload)
+	BuildingOverlay bool `yaml:"building_overlay"`
+
+	// ReloadRetry is the reconnect delay sent to browsers in the SSE retry field
+	ReloadRetry time.Duration `yaml:"reload_retry"`
+
+	// SkipInitialBuild starts the backend straight away without running the build rules first
+	SkipInitialBuild bool `yaml:"skip_initial_build"`
+
+	// InitialBuildTimeout fails a startup build command that runs longer, so a hung build
+	// doesn't keep the proxy from coming up (0 = no limit)
+	InitialBuildTimeout time.Duration `yaml:"initial_build_timeout"`
+
+	// A rule that builds more than LoopLimit times within LoopWindow, each time triggered by
+	// changes during or just after its previous build, is paused as a likely rebuild loop
+	// (defaults to 5 builds in 10s, a negative limit disables the check)
+	LoopLimit  int           `yaml:"loop_limit"`
+	LoopWindow time.Duration `yaml:"loop_window"`
+
+	// MaxLineBuffer is the longest partial line (in bytes) buffered from build and backend
+	// output before it is printed with a continuation marker
+	MaxLineBuffer int `yaml:"max_line_buffer"`
+
+	// LogLevel is one of debug, info (default), error and silent
+	LogLevel string `yaml:"log_level"`
+
+	// LogDir also writes build output to build.log and backend output to backend.log in
+	// this directory. A file is rotated at LogMaxSize bytes (default 10 MB), keeping
+	// LogMaxFiles rotated files (default 3).
+	LogDir      string `yaml:"log_dir"`
+	LogMaxSize  int64  `yaml:"log_max_size"`
+	LogMaxFiles int    `yaml:"log_max_files"`
+
+	// DisablePatternWarnings turns off the startup check that warns about
+	// watch patterns which match no existing files
+	DisablePatternWarnings bool `yaml:"disable_pattern_warnings"`
+
+	// CacheWatchDirs reuses the directory list found on the last start (kept in
+	// build_status_dir) as long as none of the directories changed, instead of walking the tree
+	CacheWatchDirs bool `yaml:"cache_watch_dirs"`
+
+	// RecursiveWatch watches the whole project with a single FSEvents stream on macOS instead
+	// of one watch per directory. Other platforms keep per-directory watches.
+	RecursiveWatch bool `yaml:"recursive_watch"`
+
+	// FollowSymlinks also watches the targets of symlinked directories below watch patterns
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+
+	// KeepStatus leaves the build status files in place on shutdown for inspection
+	KeepStatus bool `yaml:"keep_status"`
+
+	// PersistHistory keeps finished builds in HistoryFile across restarts
+	// (read by "godevwatch status --history")
+	PersistHistory bool   `yaml:"persist_history"`
+	HistoryFile    string `yaml:"history_file"`
+
+	DebugMode bool   `yaml:"-"` // Verbose logging, set via --debug or log_level: debug
+	Path      string `yaml:"-"` // File the config was loaded from
 }
 
-const defaultConfigContent = `# godevwatch configuration file
+const (
+	// DefaultPath is the config file used when neither --config nor GODEVWATCH_CONFIG is set
+	DefaultPath = "godevwatch.yaml"
+	// EnvPath names the environment variable that points at the config file
+	EnvPath = "GODEVWATCH_CONFIG"
+)
+
+// ResolvePath returns the config file to use: flagPath (from --config) if set, then
+// $GODEVWATCH_CONFIG, then ./godevwatch.yaml
+func ResolvePath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if envPath := os.Getenv(EnvPath); envPath != "" {
+		return envPath
+	}
+	return DefaultPath
+}
+
+const configTemplate = `# godevwatch configuration file
 # Place this file in your project root as godevwatch.yaml
 
+# "proxy" runs the proxy, your backend and the file watcher.
+# "watch" only rebuilds on changes, without proxy or backend.
+mode: "proxy"
+
 # Port for the development proxy server
-proxy_port: 3000
+proxy_port: {{.ProxyPort}}
 
 # Port of your backend Go server
-backend_port: 8080
+backend_port: {{.BackendPort}}
+
+# Host your backend listens on. Use an IPv6 address (e.g. "::1") for backends that
+# only listen on IPv6.
+# backend_host: "localhost"
+
+# For backends that pick their own port: find it in the backend's output (the first group
+# of this regular expression) instead of using backend_port. backend_port is the fallback
+# when nothing matches within backend_port_timeout.
+# backend_port_pattern: 'listening on .*:(\d+)'
+# backend_port_timeout: 10s
 
-# Directory where build status files are stored
+# Interface the proxy listens on. The default only accepts connections from this machine;
+# "0.0.0.0" exposes the proxy on your network (e.g. to test from a phone).
+# bind_address: "127.0.0.1"
+
+# Route paths to several backends instead (longest path_prefix wins). Each backend has
+# its own health check and down page. backend_port defaults to the first backend's port.
+# backends:
+#   - name: "api"
+#     path_prefix: "/api/"
+#     port: 8080
+#   - name: "admin"
+#     path_prefix: "/admin/"
+#     port: 8090
+
+# Proxy to a backend that speaks HTTPS (or runs on another host) instead of
+# http://localhost:<backend_port>. Skip certificate verification for self-signed dev certs.
+# backend_url: "https://localhost:8443"
+# backend_insecure_skip_verify: true
+
+# Run several services from one godevwatch: each directory has its own godevwatch.yaml with
+# its own rules, ports and run_cmd, and this proxy routes to it by path_prefix (default
+# /<name>/) or by host. Build and backend settings in this file are then not used.
+# workspaces:
+#   - ./svc-a
+#   - dir: ./svc-b
+#     host: "b.localhost"
+
+# Answer with 504 Gateway Timeout when the backend takes longer than this to start
+# responding (0 waits forever). Streamed responses (SSE, websockets) are not cut off.
+# backend_timeout: 30s
+
+# Reject proxied requests whose body is larger than this many bytes with 413 (0 = unlimited).
+# Request and response bodies are streamed, never buffered by the proxy.
+# max_request_body: 0
+
+# How often streamed response bodies are flushed to the browser. Server-Sent Events and
+# chunked responses are always flushed immediately. Negative flushes after every write.
+# flush_interval: 100ms
+
+# Directory where build status files are stored. The files godevwatch writes are removed on
+# shutdown (other files are left alone). Must be a subdirectory of the project or system temp dir.
+# Tools reading it should use current-status ("<timestamp>-<build id>-<status>"), which is
+# replaced atomically on every status change.
 build_status_dir: tmp/.build-status
 
+# Set keep_status (or pass --keep-status) to leave the build status files in place on
+# shutdown for inspection.
+# keep_status: false
+
+# Files and directories ignored by every build rule (merged with each rule's own ignore list).
+# Keep build output such as ./tmp/main here so builds never trigger themselves.
+# An entry may also list several comma-separated patterns ("vendor/**, node_modules/**").
+ignore:
+  - "tmp/**"
+  - "vendor/**"
+  - "node_modules/**"
+
+# File name patterns of editor temp files, which never trigger builds. The default covers
+# vim, emacs, JetBrains and atomic-save temp files; dotfiles such as .env are watched like any
+# other file. Setting the list replaces the default, and [] reports every file.
+# temp_file_patterns: [".#*", "#*#", "*~", "*.swp", "*.swo", "*.swx", "4913", "*.tmp", "*.tmp.*", "*___jb_tmp___", "*___jb_old___", ".DS_Store"]
+
+# Settings shared by every build rule. ignore is appended to each rule's own list,
+# the other fields (watch, command, success_pattern, failure_pattern, max_failure_streak)
+# only apply to rules that don't set them.
+# defaults:
+#   ignore:
+#     - "**/*_test.go"
+#   max_failure_streak: 3
+
 # Build rules define conditional build steps based on file changes
 # Rules are executed in order, and only run when matching files change
 build_rules:
+{{- if .Templ}}
+  - name: "templ"
+    watch:
+      - "**/*.templ"
+    command: "templ generate"
+{{end}}
   - name: "go-build"
     watch:
       - "**/*.go"
     ignore:
       - "**/*_test.go"
-      - "vendor/**"
-      - "node_modules/**"
     command: "go build -o ./tmp/main ."
+    # Generate code before the command runs (a failure skips the command). Changes to the
+    # files matching generate_outputs don't trigger this rule again.
+    # generate: "go generate ./..."
+    # generate_outputs: ["**/*_gen.go"]
+    # A list of commands runs them one after another, stopping at the first that fails:
+    # command:
+    #   - "go vet ./..."
+    #   - "go build -o ./tmp/main ."
+    # Run a different command when the changed files match a pattern (first match wins)
+    # cases:
+    #   - when: "proto/**"
+    #     command: "buf generate && go build -o ./tmp/main ."
+    # Exact files (no globs) that also trigger this rule
+    # files:
+    #   - "go.mod"
+    # Decide success from the output instead of the exit code (regular expressions)
+    # success_pattern: "Build succeeded"
+    # failure_pattern: "(?i)error:"
+    # Stop rebuilding after this many failures in a row until the next change
+    # max_failure_streak: 3
+    # Retry a failed command (e.g. a network blip during go mod download) before reporting it
+    # retries: 2
+    # retry_delay: 1s
+    # Parse errors from the output so the browser can list them ("go")
+    # parser: "go"
+    # File operations that trigger the rule: write, create, remove, rename, chmod
+    # events: ["write", "create"]
+    # File or directory (with a trailing slash) the command writes, which is never watched.
+    # "-o <path>" in the command is detected automatically. When set, a build that exits 0
+    # but leaves it missing or empty counts as failed and the backend isn't restarted.
+    # output: "./tmp/main"
+    # Rules that must never build at the same time as this one (e.g. sharing an output dir)
+    # serialize_with: ["assets"]
+    # Skip this rule in the initial build on startup (initial: false), or only run it
+    # on startup and never on changes (initial_only: true)
+    # initial: true
+    # initial_only: false
+    # Let the command read from the terminal, e.g. to answer a prompt (don't use this for
+    # rules that can build at the same time as others)
+    # interactive: false
+    # Only build when this command succeeds, skipping the rule (without failing) otherwise
+    # when_cmd: "docker info"
+    # Run the command inside a docker container (the project is mounted at workdir)
+    # container:
+    #   image: "golang:1.25"
+    #   workdir: "/src"
+    #   volumes:
+    #     - "~/go/pkg/mod:/go/pkg/mod"
+
+  # Uncomment to download modules and rebuild whenever go.mod or go.sum change.
+  # depends_on makes go-build wait for this rule when both are triggered together.
+  # - name: "go-mod"
+  #   files:
+  #     - "go.mod"
+  #     - "go.sum"
+  #   command: "go mod download && go build -o ./tmp/main ."
+{{- if .Node}}
+
+  - name: "npm-install"
+    files:
+      - "package.json"
+      - "package-lock.json"
+    command: "npm install"
+{{- end}}
+{{- if .Tailwind}}
+
+  - name: "tailwind"
+    watch:
+      - "**/*.css"
+      - "**/*.html"
+      - "**/*.templ"
+    ignore:
+      - "static/css/output.css"
+    command: "npx tailwindcss -i ./static/css/input.css -o ./static/css/output.css"
+{{- end}}
 
-# Command to run your application after successful build
+# Command to run your application after successful build. Set to "" if the backend is
+# started by another tool (air, docker, systemd): godevwatch then only proxies to
+# backend_port and reloads the browser when the backend comes back up.
+# {backend_port}, {proxy_port} and {status_dir} are replaced with their values,
+# e.g. "./tmp/main --port {backend_port}".
 run_cmd: "./tmp/main"
+
+# Commands run once on startup before the first build (e.g. "go mod download")
+# setup_cmds:
+#   - "go mod download"
+
+# Command run on shutdown, after the backend is stopped (e.g. to stop containers started
+# by setup_cmds). It is killed if it takes longer than on_shutdown_timeout.
+# on_shutdown: "docker compose down"
+# on_shutdown_timeout: 30s
+
+# How changes are applied: "build" runs the build rules and then restarts run_cmd,
+# "rerun" restarts run_cmd directly (for commands that build themselves, like "go run .")
+run_mode: "build"
+
+# Start the backend without running the build rules first (useful with run_cmd: "go run .").
+# An empty build_rules list implies this and restarts the backend whenever a .go file changes.
+# skip_initial_build: false
+
+# Fail a build command of the initial build that runs longer than this, so the proxy still
+# comes up and shows the failed build instead of hanging on startup (default: no limit)
+# initial_build_timeout: 5m
+
+# Path prefix for godevwatch's own endpoints (/__health, /__ready, /__reload, /__build-status).
+# Change this if your backend serves routes starting with /__
+internal_prefix: "__"
+
+# Paths godevwatch serves itself instead of proxying them: a file, a directory (with a
+# path ending in /*) or a built-in handler (builtin:no-content, builtin:not-found,
+# builtin:build-status). godevwatch's own endpoints can't be overridden.
+# local_routes:
+#   /favicon.ico: static/favicon.ico
+#   /__debug/*: builtin:build-status
+
+# Stop the backend after this long without requests and start it again on the next
+# request (which waits up to hold_timeout for the backend to be ready). 0 disables.
+# idle_timeout: 30m
+
+# Lengthen a rule's debounce while rapid saves keep aborting its builds, and shorten it
+# again once builds complete, between debounce_min and debounce_max.
+# adaptive_debounce: false
+# debounce_min: 100ms
+# debounce_max: 1s
+
+# Wait this long after a successful build before restarting the backend. Further
+# successful builds within the window are collapsed into a single restart.
+# restart_debounce: 300ms
+
+# Hold proxied requests while the backend restarts after a build, instead of showing
+# the down page. Requests wait at most hold_timeout for the backend to come back.
+# hold_requests_during_restart: false
+# hold_timeout: 10s
+
+# Request this path from the backend each time it comes up, before reloading the browser,
+# to prime caches. A failed warmup is logged and the browser is reloaded anyway.
+# warmup_path: "/"
+# warmup_timeout: 5s
+
+# Open the proxy in your default browser on startup (or use --open / --no-open)
+# open_browser: false
+
+# Command run once, the first time the backend is up after startup (not after restarts)
+# on_first_ready: "open http://localhost:3000"
+
+# Commands run each time the backend comes up or goes down, with GODEVWATCH_BACKEND_STATUS
+# (up/down) and GODEVWATCH_BACKEND (the backend's name) in their environment
+# on_backend_up: "notify-send 'backend up'"
+# on_backend_down: "notify-send 'backend down'"
+
+# Commands run after each build triggered by a change, with GODEVWATCH_RULE (and
+# GODEVWATCH_ERROR for failures) in their environment
+# on_success: "notify-send \"built $GODEVWATCH_RULE\""
+# on_failure: "notify-send \"$GODEVWATCH_RULE failed\""
+
+# On startup, hold requests for up to this long while the initial build runs and the
+# backend starts, so opening the browser right away doesn't show the down page. 0 disables.
+# startup_hold: 30s
+
+# Pause builds while a git operation (checkout, rebase, merge) is rewriting files,
+# then run a single build once it finishes. git_lock_file is the marker that is checked.
+# pause_on_git: false
+# git_lock_file: ".git/index.lock"
+
+# Browser auto-reload. Set to false for API-only backends without a browser.
+reload: true
+
+# Number of reload events buffered per browser client, and what happens when a slow
+# client's buffer is full: "coalesce" keeps only the latest event, "drop-oldest" discards
+# the oldest buffered event, "drop-newest" discards the event being sent
+reload_buffer_size: 1
+reload_drop_policy: "coalesce"
+
+# Most browser tabs connected to the reload stream at once (per backend). Further
+# connections get 503, so a runaway script can't exhaust the proxy.
+# max_reload_clients: 100
+
+# How quickly browsers reconnect to the reload stream after the connection drops
+reload_retry: 1s
+
+# While a rebuild runs, keep serving the old backend and show a small "Rebuilding…" banner
+# on its HTML pages, which hides once the new backend is up. Compressed pages are left alone.
+# building_overlay: false
+
+# Keep a rolling log of finished builds that survives restarts, shown by
+# "godevwatch status --history". history_file must be outside build_status_dir.
+# persist_history: false
+# history_file: "tmp/.godevwatch-history.jsonl"
+
+# Pause a rule that builds more than loop_limit times within loop_window, each time triggered
+# by files changed while it was building or just after, which usually means its output is
+# being watched. Set loop_limit to -1 to disable the check.
+# loop_limit: 5
+# loop_window: 10s
+
+# Longest line (in bytes) buffered from build and backend output before it is printed
+# anyway, ending in "…". Protects against tools that print progress without newlines.
+# max_line_buffer: 65536
+
+# How much to log: "debug" (like --debug), "info", "error" (only errors and warnings,
+# like --quiet) or "silent" (also hides build and backend output, like --silent)
+# log_level: "info"
+
+# Also write build and backend output to build.log and backend.log in this directory, with
+# timestamps. Files are rotated at log_max_size bytes, keeping log_max_files old ones.
+# log_dir: "tmp/logs"
+# log_max_size: 10485760
+# log_max_files: 3
+
+# Set to true to silence warnings about watch patterns that match no files
+# disable_pattern_warnings: false
+
+# Speed up startup in huge repositories by reusing the directories found on the last start.
+# The tree is walked again whenever a watched directory was added, removed or changed.
+# cache_watch_dirs: false
+
+# On macOS, watch the whole project with a single FSEvents stream instead of one watch per
+# directory, which is much lighter on deep trees. Ignored on other platforms.
+# recursive_watch: false
+
+# Also watch the targets of symlinked directories (e.g. shared code linked into the project).
+# Changes there trigger rules as if they happened below the symlink.
+# follow_symlinks: false
 `
 
 // Init creates a new godevwatch.yaml file with default settings
 func Init() error {
-	return os.WriteFile("godevwatch.yaml", []byte(defaultConfigContent), 0644)
+	return InitWith(DefaultPath, DefaultInitOptions())
+}
+
+// InitWith creates a new config file at path generated from opts
+func InitWith(path string, opts InitOptions) error {
+	content, err := Generate(opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// Load reads and parses the configuration file at path
+func Load(path string) (*Config, error) {
+	return load(path, ".")
+}
+
+// LoadWorkspace reads and parses the configuration file of a workspace, whose godevwatch
+// runs in the workspace's directory, so relative paths in it are resolved against that
+func LoadWorkspace(ws Workspace) (*Config, error) {
+	return load(ws.Config, ws.Dir)
 }
 
-// Load reads and parses the godevwatch.yaml configuration file
-func Load() (*Config, error) {
+// load reads and parses the configuration file at path, for a godevwatch running in dir
+func load(path, dir string) (*Config, error) {
 	// Check if config file exists
-	data, err := os.ReadFile("godevwatch.yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("godevwatch.yaml not found. Run 'godevwatch init' to create one")
+			return nil, fmt.Errorf("%s: %w", path, ErrConfigNotFound)
 		}
 		return nil, err
 	}
 
-	var cfg Config
+	// Defaults that an explicit empty value in the file must be able to override
+	cfg := Config{RunCmd: "./tmp/main"}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, &ParseError{Path: path, Err: err}
 	}
+	cfg.Path = path
 
 	// Set defaults if not specified
+	if cfg.Mode == "" {
+		cfg.Mode = ModeProxy
+	}
+	if cfg.Mode != ModeProxy && cfg.Mode != ModeWatch {
+		return nil, invalid("mode", "invalid mode %q (expected %q or %q)", cfg.Mode, ModeProxy, ModeWatch)
+	}
 	if cfg.ProxyPort == 0 {
 		cfg.ProxyPort = 3000
 	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = LogLevelInfo
+	}
+	switch cfg.LogLevel {
+	case LogLevelDebug:
+		cfg.DebugMode = true
+	case LogLevelInfo, LogLevelError, LogLevelSilent:
+	default:
+		return nil, invalid("log_level", "invalid log_level %q (expected debug, info, error or silent)", cfg.LogLevel)
+	}
+	if cfg.BindAddress == "" {
+		cfg.BindAddress = "127.0.0.1"
+	}
+	if cfg.BackendHost == "" {
+		cfg.BackendHost = "localhost"
+	}
+	cfg.BackendHost = strings.TrimSuffix(strings.TrimPrefix(cfg.BackendHost, "["), "]")
+	if strings.ContainsAny(cfg.BackendHost, "/[]") {
+		return nil, invalid("backend_host", "invalid backend_host %q (expected a host name or IP address)", cfg.BackendHost)
+	}
+	if cfg.BackendURL != "" {
+		backendURL, port, err := parseBackendURL(cfg.BackendURL)
+		if err != nil {
+			return nil, invalid("backend_url", "invalid backend_url: %w", err)
+		}
+		cfg.BackendURL = backendURL
+		if cfg.BackendPort == 0 {
+			cfg.BackendPort = port
+		}
+	}
+	if cfg.BackendPort == 0 && len(cfg.Backends) > 0 {
+		cfg.BackendPort = cfg.Backends[0].Port
+	}
 	if cfg.BackendPort == 0 {
 		cfg.BackendPort = 8080
 	}
+	if cfg.BackendPortPattern != "" {
+		re, err := regexp.Compile(cfg.BackendPortPattern)
+		if err != nil {
+			return nil, invalid("backend_port_pattern", "invalid backend_port_pattern: %w", err)
+		}
+		if re.NumSubexp() == 0 {
+			return nil, invalid("backend_port_pattern", "backend_port_pattern %q has no group capturing the port", cfg.BackendPortPattern)
+		}
+	}
+	if cfg.OnShutdownTimeout <= 0 {
+		cfg.OnShutdownTimeout = 30 * time.Second
+	}
+	if cfg.BackendPortTimeout <= 0 {
+		cfg.BackendPortTimeout = 10 * time.Second
+	}
+	if len(cfg.Backends) == 0 {
+		cfg.Backends = []Backend{{Name: "default", PathPrefix: "/", Port: cfg.BackendPort, URL: cfg.BackendURL}}
+	}
+	for i := range cfg.Backends {
+		backend := &cfg.Backends[i]
+		if backend.URL != "" {
+			backendURL, port, err := parseBackendURL(backend.URL)
+			if err != nil {
+				return nil, invalid(fmt.Sprintf("backends[%d].url", i), "backend %d (%s) has an invalid url: %w", i, backend.Name, err)
+			}
+			backend.URL = backendURL
+			if backend.Port == 0 {
+				backend.Port = port
+			}
+		}
+		if backend.Port == 0 {
+			return nil, invalid(fmt.Sprintf("backends[%d].port", i), "backend %d (%s) has no port", i, backend.Name)
+		}
+		if backend.URL == "" {
+			backend.URL = "http://" + net.JoinHostPort(cfg.BackendHost, strconv.Itoa(backend.Port))
+		}
+		if backend.Name == "" {
+			backend.Name = fmt.Sprintf("backend-%d", backend.Port)
+		}
+		if backend.PathPrefix == "" {
+			backend.PathPrefix = "/"
+		}
+	}
+	if err := validateWorkspaces(cfg.Workspaces, dir); err != nil {
+		return nil, err
+	}
 	if cfg.BuildStatusDir == "" {
 		cfg.BuildStatusDir = "tmp/.build-status"
 	}
-	if cfg.RunCmd == "" {
-		cfg.RunCmd = "./tmp/main"
+	if cfg.BuildStatusDir, err = validateStatusDir(cfg.BuildStatusDir); err != nil {
+		return nil, err
+	}
+	if cfg.HistoryFile == "" {
+		cfg.HistoryFile = "tmp/.godevwatch-history.jsonl"
+	}
+	if cfg.PersistHistory && isWithin(cfg.HistoryFile, cfg.BuildStatusDir) {
+		return nil, invalid("history_file", "history_file %q must be outside build_status_dir %q, which is removed on shutdown", cfg.HistoryFile, cfg.BuildStatusDir)
+	}
+	if cfg.InternalPrefix == "" {
+		cfg.InternalPrefix = "__"
+	}
+	for route, target := range cfg.LocalRoutes {
+		if err := cfg.validateLocalRoute(route, target); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RunMode == "" {
+		cfg.RunMode = RunModeBuild
+	}
+	if cfg.RunMode != RunModeBuild && cfg.RunMode != RunModeRerun {
+		return nil, invalid("run_mode", "invalid run_mode %q (expected %q or %q)", cfg.RunMode, RunModeBuild, RunModeRerun)
+	}
+
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = 100 * time.Millisecond
+	}
+	if cfg.TempFilePatterns == nil {
+		cfg.TempFilePatterns = DefaultTempFilePatterns
+	}
+	for i, pattern := range cfg.TempFilePatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, invalid(fmt.Sprintf("temp_file_patterns[%d]", i), "invalid temp_file_patterns entry %q: %w", pattern, err)
+		}
+	}
+	if cfg.DebounceMin <= 0 {
+		cfg.DebounceMin = 100 * time.Millisecond
+	}
+	if cfg.DebounceMax <= 0 {
+		cfg.DebounceMax = time.Second
+	}
+	if cfg.DebounceMax < cfg.DebounceMin {
+		return nil, invalid("debounce_max", "debounce_max (%s) is shorter than debounce_min (%s)", cfg.DebounceMax, cfg.DebounceMin)
+	}
+	if cfg.WarmupTimeout <= 0 {
+		cfg.WarmupTimeout = 5 * time.Second
+	}
+	if cfg.HoldTimeout <= 0 {
+		cfg.HoldTimeout = 10 * time.Second
+	}
+	if cfg.GitLockFile == "" {
+		cfg.GitLockFile = ".git/index.lock"
+	}
+	if cfg.MaxReloadClients <= 0 {
+		cfg.MaxReloadClients = 100
+	}
+	if cfg.ReloadBufferSize <= 0 {
+		cfg.ReloadBufferSize = 1
+	}
+	if cfg.ReloadRetry <= 0 {
+		cfg.ReloadRetry = time.Second
+	}
+	if cfg.LogMaxSize <= 0 {
+		cfg.LogMaxSize = 10 * 1024 * 1024
+	}
+	if cfg.LogMaxFiles < 0 {
+		return nil, invalid("log_max_files", "log_max_files must not be negative")
+	}
+	if cfg.LogMaxFiles == 0 {
+		cfg.LogMaxFiles = 3
+	}
+	if cfg.MaxLineBuffer <= 0 {
+		cfg.MaxLineBuffer = logger.DefaultMaxLineBuffer
+	}
+	if cfg.LoopLimit == 0 {
+		cfg.LoopLimit = 5
+	}
+	if cfg.LoopWindow <= 0 {
+		cfg.LoopWindow = 10 * time.Second
+	}
+	if cfg.ReloadDropPolicy == "" {
+		cfg.ReloadDropPolicy = "coalesce"
+	}
+	switch cfg.ReloadDropPolicy {
+	case "coalesce", "drop-oldest", "drop-newest":
+	default:
+		return nil, invalid("reload_drop_policy", "invalid reload_drop_policy %q (expected coalesce, drop-oldest or drop-newest)", cfg.ReloadDropPolicy)
+	}
+
+	if _, err := cfg.RunCommand(); err != nil {
+		return nil, err
+	}
+
+	// In rerun mode the run command builds the application itself
+	if cfg.RunMode == RunModeRerun && cfg.ExternalBackend() {
+		return nil, invalid("run_mode", "run_mode %q needs a run_cmd", RunModeRerun)
+	}
+	if cfg.BackendPortPattern != "" && cfg.ExternalBackend() {
+		return nil, invalid("backend_port_pattern", "backend_port_pattern needs a run_cmd whose output it can read")
+	}
+	if cfg.RunMode == RunModeRerun {
+		cfg.SkipInitialBuild = true
+	}
+
+	// Accept comma-separated patterns ("vendor/**,node_modules/**") as generated by some tools
+	cfg.Ignore = splitPatterns(cfg.Ignore)
+	cfg.Defaults.Ignore = splitPatterns(cfg.Defaults.Ignore)
+	cfg.Defaults.Watch = splitPatterns(cfg.Defaults.Watch)
+	for i := range cfg.BuildRules {
+		cfg.BuildRules[i].Watch = splitPatterns(cfg.BuildRules[i].Watch)
+		cfg.BuildRules[i].Ignore = splitPatterns(cfg.BuildRules[i].Ignore)
+		cfg.BuildRules[i].GenerateOutputs = splitPatterns(cfg.BuildRules[i].GenerateOutputs)
+	}
+
+	// Merge the shared defaults into every rule
+	for i := range cfg.BuildRules {
+		cfg.Defaults.apply(&cfg.BuildRules[i])
+	}
+
+	// Validate output patterns and events
+	for i, rule := range cfg.BuildRules {
+		if rule.Container != nil && rule.Container.Workdir == "" {
+			cfg.BuildRules[i].Container.Workdir = "/src"
+		}
+		if len(rule.GenerateOutputs) > 0 && len(rule.Generate) == 0 {
+			return nil, invalid(fmt.Sprintf("build_rules[%d].generate_outputs", i), "build rule %q has generate_outputs but no generate command", rule.Name)
+		}
+		if rule.Retries < 0 {
+			return nil, invalid(fmt.Sprintf("build_rules[%d].retries", i), "build rule %q has negative retries", rule.Name)
+		}
+		if rule.Retries > 0 && rule.RetryDelay == 0 {
+			cfg.BuildRules[i].RetryDelay = time.Second
+		}
+		if rule.Parser != "" && rule.Parser != ParserGo {
+			return nil, invalid(fmt.Sprintf("build_rules[%d].parser", i), "build rule %q has an unknown parser %q (expected %q)", rule.Name, rule.Parser, ParserGo)
+		}
+		if rule.InitialOnly && !rule.RunsInitially() {
+			return nil, invalid(fmt.Sprintf("build_rules[%d].initial_only", i), "build rule %q sets both initial: false and initial_only: true, so it would never run", rule.Name)
+		}
+		if rule.Container != nil && rule.Container.Image == "" {
+			return nil, invalid(fmt.Sprintf("build_rules[%d].container.image", i), "build rule %q has a container without an image", rule.Name)
+		}
+		for _, event := range rule.Events {
+			switch event {
+			case EventWrite, EventCreate, EventRemove, EventRename, EventChmod:
+			default:
+				return nil, invalid(fmt.Sprintf("build_rules[%d].events", i), "build rule %q has an invalid event %q (expected write, create, remove, rename or chmod)", rule.Name, event)
+			}
+		}
+		for _, p := range []struct{ field, pattern string }{{"success_pattern", rule.SuccessPattern}, {"failure_pattern", rule.FailurePattern}} {
+			if _, err := regexp.Compile(p.pattern); err != nil {
+				return nil, invalid(fmt.Sprintf("build_rules[%d].%s", i, p.field), "build rule %q has an invalid pattern %q: %w", rule.Name, p.pattern, err)
+			}
+		}
+	}
+
+	// Make sure rule dependencies exist and don't form a cycle
+	if _, err := cfg.OrderedRules(); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, rule := range cfg.BuildRules {
+		names[rule.Name] = true
+	}
+	for i, rule := range cfg.BuildRules {
+		for _, other := range rule.SerializeWith {
+			if !names[other] || other == rule.Name {
+				return nil, invalid(fmt.Sprintf("build_rules[%d].serialize_with", i), "build rule %q has an invalid serialize_with rule %q", rule.Name, other)
+			}
+		}
+	}
+
+	// Without build rules there is no build step, the backend is simply restarted on changes
+	if len(cfg.BuildRules) == 0 {
+		cfg.BuildRules = []BuildRule{restartRule()}
+		cfg.SkipInitialBuild = true
 	}
 
 	return &cfg, nil
 }
+
+// splitPatterns splits comma-separated entries into separate patterns, trimming whitespace
+// and dropping empty entries. Commas inside {} alternatives are kept.
+func splitPatterns(patterns []string) []string {
+	if patterns == nil {
+		return nil
+	}
+
+	split := []string{}
+	for _, entry := range patterns {
+		depth, start := 0, 0
+		for i, c := range entry {
+			switch {
+			case c == '{':
+				depth++
+			case c == '}' && depth > 0:
+				depth--
+			case c == ',' && depth == 0:
+				split = appendPattern(split, entry[start:i])
+				start = i + 1
+			}
+		}
+		split = appendPattern(split, entry[start:])
+	}
+	return split
+}
+
+// appendPattern appends pattern without surrounding whitespace, unless it is empty
+func appendPattern(patterns []string, pattern string) []string {
+	if pattern = strings.TrimSpace(pattern); pattern != "" {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// parseBackendURL validates a backend URL and returns it with an explicit port, along with the port
+func parseBackendURL(raw string) (string, int, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", 0, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", 0, fmt.Errorf("%q must start with http:// or https://", raw)
+	}
+	if u.Hostname() == "" {
+		return "", 0, fmt.Errorf("%q has no host", raw)
+	}
+
+	portStr := u.Port()
+	if portStr == "" {
+		portStr = "80"
+		if u.Scheme == "https" {
+			portStr = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), portStr)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("%q has an invalid port", raw)
+	}
+	return u.String(), port, nil
+}
+
+// validateStatusDir normalizes build_status_dir and rejects values whose cleanup on shutdown
+// could delete user files: it must be a directory inside the project or the system temp dir
+func validateStatusDir(dir string) (string, error) {
+	clean := filepath.Clean(dir)
+
+	if filepath.IsAbs(clean) {
+		tmp := filepath.Clean(os.TempDir())
+		if clean != tmp && isWithin(clean, tmp) {
+			return clean, nil
+		}
+		return "", invalid("build_status_dir", "build_status_dir %q must be a relative path inside the project or a directory under %s", dir, tmp)
+	}
+
+	if clean == "." || !isWithin(clean, ".") {
+		return "", invalid("build_status_dir", "build_status_dir %q must be a subdirectory of the project", dir)
+	}
+	if clean == ".git" || isWithin(clean, ".git") {
+		return "", invalid("build_status_dir", "build_status_dir %q must not be inside .git", dir)
+	}
+	return clean, nil
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// restartRule returns a no-op build rule that only exists to restart the backend on changes
+func restartRule() BuildRule {
+	return BuildRule{
+		Name:    "restart",
+		Watch:   []string{"**/*.go"},
+		Ignore:  []string{"**/*_test.go", "vendor/**", "node_modules/**"},
+		Command: Commands{"true"},
+	}
+}
+
+// OrderedRules returns the build rules sorted so that every rule comes after its
+// dependencies. Rules without dependency constraints keep their configured order.
+func (c *Config) OrderedRules() ([]BuildRule, error) {
+	byName := make(map[string]int)
+	for i, rule := range c.BuildRules {
+		byName[rule.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(c.BuildRules))
+	ordered := make([]BuildRule, 0, len(c.BuildRules))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return invalid(fmt.Sprintf("build_rules[%d].depends_on", i), "build rule %q has a circular depends_on", c.BuildRules[i].Name)
+		}
+
+		state[i] = visiting
+		for _, dep := range c.BuildRules[i].DependsOn {
+			j, ok := byName[dep]
+			if !ok {
+				return invalid(fmt.Sprintf("build_rules[%d].depends_on", i), "build rule %q depends on unknown rule %q", c.BuildRules[i].Name, dep)
+			}
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		ordered = append(ordered, c.BuildRules[i])
+		return nil
+	}
+
+	for i := range c.BuildRules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// placeholderPattern matches {name} placeholders in run_cmd. ${NAME} is left to the shell.
+var placeholderPattern = regexp.MustCompile(`(\$?)\{([a-z_]+)\}`)
+
+// RunCommand returns run_cmd with its {backend_port}, {proxy_port} and {status_dir}
+// placeholders filled in
+func (c *Config) RunCommand() (string, error) {
+	values := map[string]string{
+		"backend_port": strconv.Itoa(c.BackendPort),
+		"proxy_port":   strconv.Itoa(c.ProxyPort),
+		"status_dir":   c.BuildStatusDir,
+	}
+
+	var err error
+	command := placeholderPattern.ReplaceAllStringFunc(c.RunCmd, func(match string) string {
+		parts := placeholderPattern.FindStringSubmatch(match)
+		if parts[1] == "$" {
+			return match
+		}
+		value, ok := values[parts[2]]
+		if !ok && err == nil {
+			err = invalid("run_cmd", "run_cmd has an unknown placeholder %s (expected {backend_port}, {proxy_port} or {status_dir})", match)
+		}
+		return value
+	})
+	return command, err
+}
+
+// ExternalBackend reports whether the backend is managed outside godevwatch (empty run_cmd)
+func (c *Config) ExternalBackend() bool {
+	return c.RunCmd == ""
+}
+
+// ReloadEnabled reports whether browser auto-reload is enabled
+func (c *Config) ReloadEnabled() bool {
+	return c.Reload == nil || *c.Reload
+}
+
+// ProxyAddr returns the address the proxy listens on
+func (c *Config) ProxyAddr() string {
+	return net.JoinHostPort(c.BindAddress, strconv.Itoa(c.ProxyPort))
+}
+
+// ProxyURL returns the URL to reach the proxy on this machine
+func (c *Config) ProxyURL() string {
+	host := c.BindAddress
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(c.ProxyPort))
+}
+
+// ExposesProxy reports whether the proxy listens on all interfaces
+func (c *Config) ExposesProxy() bool {
+	ip := net.ParseIP(c.BindAddress)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// validateWorkspaces fills in the defaults of each workspace and checks that their
+// directories (relative to dir) exist and their names and routes are unique
+func validateWorkspaces(workspaces []Workspace, dir string) error {
+	names := make(map[string]bool)
+	routes := make(map[string]string)
+	for i := range workspaces {
+		ws := &workspaces[i]
+		if ws.Dir == "" {
+			return invalid(fmt.Sprintf("workspaces[%d].dir", i), "workspace %d has no dir", i)
+		}
+		ws.Dir = filepath.Clean(ws.Dir)
+		if info, err := os.Stat(filepath.Join(dir, ws.Dir)); err != nil || !info.IsDir() {
+			return invalid(fmt.Sprintf("workspaces[%d].dir", i), "workspace dir %q is not a directory", ws.Dir)
+		}
+		if ws.Name == "" {
+			ws.Name = filepath.Base(ws.Dir)
+		}
+		if names[ws.Name] {
+			return invalid(fmt.Sprintf("workspaces[%d].name", i), "workspace name %q is used twice (set name to tell them apart)", ws.Name)
+		}
+		names[ws.Name] = true
+		if ws.Config == "" {
+			ws.Config = filepath.Join(ws.Dir, DefaultPath)
+		}
+		if ws.Host == "" && ws.PathPrefix == "" {
+			ws.PathPrefix = "/" + ws.Name + "/"
+		}
+		if ws.PathPrefix != "" {
+			if !strings.HasPrefix(ws.PathPrefix, "/") {
+				return invalid(fmt.Sprintf("workspaces[%d].path_prefix", i), "workspace %s has a path_prefix %q that doesn't start with /", ws.Name, ws.PathPrefix)
+			}
+			if !strings.HasSuffix(ws.PathPrefix, "/") {
+				ws.PathPrefix += "/"
+			}
+		}
+
+		route := ws.PathPrefix
+		if ws.Host != "" {
+			ws.Host = strings.ToLower(ws.Host)
+			route = ws.Host
+		}
+		if other, taken := routes[route]; taken {
+			return invalid(fmt.Sprintf("workspaces[%d]", i), "workspaces %s and %s both route %s", other, ws.Name, route)
+		}
+		routes[route] = ws.Name
+	}
+	return nil
+}
+
+// InternalPath returns the URL path of one of godevwatch's own endpoints
+func (c *Config) InternalPath(name string) string {
+	return "/" + c.InternalPrefix + name
+}
+
+// validateLocalRoute checks a local_routes entry. Routes may live under internal_prefix,
+// but not replace one of godevwatch's own endpoints.
+func (c *Config) validateLocalRoute(route, target string) error {
+	if !strings.HasPrefix(route, "/") {
+		return invalid("local_routes["+route+"]", "local_routes path %q must start with /", route)
+	}
+	if strings.Contains(strings.TrimSuffix(route, "/*"), "*") {
+		return invalid("local_routes["+route+"]", "local_routes path %q may only end in /* to match everything below it", route)
+	}
+	for _, endpoint := range InternalEndpoints {
+		if route == c.InternalPath(endpoint) {
+			return invalid("local_routes["+route+"]", "local_routes path %q is reserved for godevwatch's own endpoint", route)
+		}
+	}
+	if target == "" {
+		return invalid("local_routes["+route+"]", "local_routes path %q has no file or handler", route)
+	}
+	if name, ok := strings.CutPrefix(target, "builtin:"); ok && !slices.Contains(LocalRouteBuiltins, name) {
+		return invalid("local_routes["+route+"]", "local_routes path %q has an unknown handler %q (expected one of %s)", route, target, strings.Join(LocalRouteBuiltins, ", "))
+	}
+	return nil
+}
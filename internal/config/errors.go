@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrConfigNotFound is returned (wrapped, with the path) by Load when the config file doesn't exist
+var ErrConfigNotFound = errors.New("config file not found")
+
+// ParseError is returned by Load when the config file isn't valid YAML or a value has the
+// wrong type
+type ParseError struct {
+	Path string
+	Err  error // The YAML error, which names the line
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by Load when a setting has an invalid value
+type ValidationError struct {
+	// Field is the setting's path in the config file, e.g. "log_level",
+	// "backends[1].url" or "build_rules[0].retries"
+	Field   string
+	Message string // Describes the problem, naming the setting
+	Err     error  // Underlying error, if any
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// invalid returns a ValidationError for field, formatting its message like fmt.Errorf (so
+// %w keeps the underlying error)
+func invalid(field, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &ValidationError{Field: field, Message: err.Error(), Err: errors.Unwrap(err)}
+}
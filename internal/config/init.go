@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Project templates for godevwatch init
+const (
+	// TemplateGo builds a plain Go binary
+	TemplateGo = "go"
+	// TemplateWeb also builds Tailwind CSS
+	TemplateWeb = "web"
+	// TemplateFullstack also generates templ components and builds Tailwind CSS
+	TemplateFullstack = "fullstack"
+)
+
+// Templates lists the project templates in the order they are offered
+var Templates = []string{TemplateGo, TemplateWeb, TemplateFullstack}
+
+// InitOptions customizes the generated godevwatch.yaml
+type InitOptions struct {
+	ProxyPort   int
+	BackendPort int
+	Templ       bool // Add a rule that runs "templ generate"
+	Tailwind    bool // Add a rule that builds Tailwind CSS
+	Node        bool // Add a rule that runs "npm install" when package.json changes
+}
+
+// DefaultInitOptions returns the options of the default configuration
+func DefaultInitOptions() InitOptions {
+	return InitOptions{ProxyPort: 3000, BackendPort: 8080}
+}
+
+// TemplateOptions returns the default options with the rules of a project template
+func TemplateOptions(name string) (InitOptions, error) {
+	opts := DefaultInitOptions()
+	switch name {
+	case TemplateGo:
+	case TemplateWeb:
+		opts.Tailwind = true
+	case TemplateFullstack:
+		opts.Templ = true
+		opts.Tailwind = true
+	default:
+		return opts, fmt.Errorf("unknown template %q (expected %s)", name, strings.Join(Templates, ", "))
+	}
+	return opts, nil
+}
+
+// Generate renders a commented godevwatch.yaml from opts
+func Generate(opts InitOptions) (string, error) {
+	tmpl, err := template.New("godevwatch.yaml").Parse(configTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, opts); err != nil {
+		return "", fmt.Errorf("failed to generate config: %w", err)
+	}
+	return b.String(), nil
+}
+
+// errFound stops a directory walk early
+var errFound = errors.New("found")
+
+// Detect inspects a project directory and returns default options with the rules its
+// stack needs: templ components, Tailwind CSS and npm dependencies
+func Detect(dir string) InitOptions {
+	opts := DefaultInitOptions()
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	for _, name := range []string{"tailwind.config.js", "tailwind.config.cjs", "tailwind.config.mjs", "tailwind.config.ts"} {
+		if exists(name) {
+			opts.Tailwind = true
+		}
+	}
+	// The Tailwind rule runs through npx, so a separate npm rule is only added without it
+	opts.Node = exists("package.json") && !opts.Tailwind
+	opts.Templ = containsTemplFiles(dir)
+
+	return opts
+}
+
+// containsTemplFiles reports whether any .templ file exists below dir
+func containsTemplFiles(dir string) bool {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", "node_modules", "vendor", "tmp":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".templ") {
+			return errFound
+		}
+		return nil
+	})
+	return err == errFound
+}
+
+// Describe names the stack opts generates rules for, e.g. "Go + templ + Tailwind CSS"
+func (o InitOptions) Describe() string {
+	parts := []string{"Go"}
+	if o.Templ {
+		parts = append(parts, "templ")
+	}
+	if o.Tailwind {
+		parts = append(parts, "Tailwind CSS")
+	}
+	if o.Node {
+		parts = append(parts, "npm")
+	}
+	return strings.Join(parts, " + ")
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    InitOptions
+		rules   []string
+	}{
+		{"go", InitOptions{}, []string{"go-build"}},
+		{"templ", InitOptions{Templ: true}, []string{"templ", "go-build"}},
+		{"node", InitOptions{Node: true}, []string{"go-build", "npm-install"}},
+		{"tailwind", InitOptions{Tailwind: true}, []string{"go-build", "tailwind"}},
+		{"tailwind-ts", InitOptions{Tailwind: true}, []string{"go-build", "tailwind"}},
+		{"fullstack", InitOptions{Templ: true, Tailwind: true}, []string{"templ", "go-build", "tailwind"}},
+
+		// .templ files of dependencies don't make the project a templ project
+		{"vendored-templ", InitOptions{Node: true}, []string{"go-build", "npm-install"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			opts := Detect(filepath.Join("testdata", "stacks", tt.fixture))
+
+			want := tt.want
+			want.ProxyPort, want.BackendPort = DefaultInitOptions().ProxyPort, DefaultInitOptions().BackendPort
+			if opts != want {
+				t.Errorf("Detect = %+v, want %+v", opts, want)
+			}
+
+			// The suggested config has a rule for each part of the stack
+			generated, err := Generate(opts)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			var cfg Config
+			if err := yaml.Unmarshal([]byte(generated), &cfg); err != nil {
+				t.Fatalf("generated config doesn't parse: %v", err)
+			}
+			var rules []string
+			for _, rule := range cfg.BuildRules {
+				rules = append(rules, rule.Name)
+			}
+			if !slices.Equal(rules, tt.rules) {
+				t.Errorf("generated rules = %v, want %v", rules, tt.rules)
+			}
+		})
+	}
+}
+
+func TestDetectMissingDir(t *testing.T) {
+	if opts := Detect(filepath.Join("testdata", "stacks", "missing")); opts != DefaultInitOptions() {
+		t.Errorf("Detect of a missing directory = %+v, want the defaults", opts)
+	}
+}
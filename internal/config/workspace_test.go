@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadWorkspace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "svc-a")
+	if err := os.MkdirAll(filepath.Join(dir, "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, DefaultPath)
+	if err := os.WriteFile(path, []byte("workspaces: [./api]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The workspace's own workspaces are relative to its directory, not the working directory
+	cfg, err := LoadWorkspace(Workspace{Name: "svc-a", Dir: dir, Config: path})
+	if err != nil {
+		t.Fatalf("LoadWorkspace: %v", err)
+	}
+	if len(cfg.Workspaces) != 1 || cfg.Workspaces[0].Dir != "api" {
+		t.Errorf("workspaces = %+v, want api", cfg.Workspaces)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load resolved the workspace's dirs against the working directory")
+	}
+
+	// Settings it leaves out get the usual defaults
+	if cfg.ProxyPort != 3000 || cfg.InternalPath("ready") != "/__ready" {
+		t.Errorf("proxy_port %d and ready endpoint %s, want the defaults", cfg.ProxyPort, cfg.InternalPath("ready"))
+	}
+}
+
+func TestLocalRouteCantShadowWorkspaces(t *testing.T) {
+	cfg := &Config{InternalPrefix: "__"}
+	if err := cfg.validateLocalRoute("/__workspaces", "builtin:no-content"); err == nil {
+		t.Error("a local route replaced the workspaces endpoint")
+	}
+}
@@ -2,11 +2,16 @@ package health
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,44 +27,156 @@ const (
 	StatusUp
 )
 
+// DropPolicy controls what happens when a reload client's buffer is full
+type DropPolicy int
+
+const (
+	// Coalesce discards everything buffered and keeps only the latest message
+	Coalesce DropPolicy = iota
+	// DropOldest discards the oldest buffered message to make room for the new one
+	DropOldest
+	// DropNewest discards the message being sent
+	DropNewest
+)
+
+// ParseDropPolicy converts a config value into a DropPolicy
+func ParseDropPolicy(name string) DropPolicy {
+	switch name {
+	case "drop-oldest":
+		return DropOldest
+	case "drop-newest":
+		return DropNewest
+	default:
+		return Coalesce
+	}
+}
+
+// Probe checks whether the backend is reachable, returning nil when it is
+type Probe func(ctx context.Context) error
+
+// probeTimeout bounds a single health probe
+const probeTimeout = 500 * time.Millisecond
+
+// healthCheckInterval is the time between health checks, before jitter
+const healthCheckInterval = 1 * time.Second
+
+// jitter randomizes d by up to ±20%. math/rand/v2 is seeded per process, so instances
+// started together drift apart.
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d) / 5
+	return d + time.Duration(rand.Int64N(2*spread+1)-spread)
+}
+
+// TCPProbe returns a probe that dials the given address (faster than an HTTP request)
+func TCPProbe(addr string) Probe {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
 // Monitor manages backend health monitoring and proxy switching
 type Monitor struct {
-	config            *config.Config
-	status            Status
-	statusMu          sync.RWMutex
-	proxy             *httputil.ReverseProxy
-	backendURL        *url.URL
-	healthCheckTicker *time.Ticker
-	onStatusChange    func(Status)
-
-	// Client connections for auto-reload
-	reloadClients   map[chan string]bool
+	config         *config.Config
+	backend        config.Backend
+	status         Status
+	statusMu       sync.RWMutex
+	proxy          *httputil.ReverseProxy
+	backendURL     *url.URL // Guarded by statusMu, changed by SetBackendPort
+	onStatusChange []func(oldStatus, newStatus Status)
+	probe          Probe
+
+	// awaitingPort keeps the backend down until SetBackendPort reports where it listens
+	awaitingPort bool
+
+	// resets counts MarkDown and AwaitBackendPort calls, so a probe that started before one
+	// doesn't report the old backend as up
+	resets uint64
+
+	// generation increases every time the backend comes up, so clients can tell they missed a reload
+	generation uint64
+
+	// upCh is closed (and replaced) whenever the backend comes up
+	upCh chan struct{}
+
+	// Client connections for auto-reload, keyed by the channel handed out to the client
+	reloadClients   map[<-chan string]reloadClient
 	reloadClientsMu sync.RWMutex
 }
 
-// NewMonitor creates a new backend health monitor
-func NewMonitor(cfg *config.Config) *Monitor {
-	backendURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("localhost:%d", cfg.BackendPort),
-	}
+// reloadClient is a browser connected for auto-reload
+type reloadClient struct {
+	events chan string
+	policy DropPolicy
+}
+
+// NewMonitor creates a new health monitor for a backend
+func NewMonitor(cfg *config.Config, backend config.Backend) *Monitor {
+	// config.Load has already validated the URL
+	backendURL, _ := url.Parse(backend.URL)
 
+	// Responses announcing trailers are chunked, so ReverseProxy flushes each chunk right away
+	// and forwards the trailers once the body is done, along with the client's "TE: trailers"
 	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.FlushInterval = cfg.FlushInterval
+
+	// Accept self-signed certificates of HTTPS backends in development, and give up on
+	// backends that hang before responding. Streamed responses (SSE, websockets) only need
+	// their headers in time, so they aren't cut off.
+	if cfg.BackendInsecureSkipVerify || cfg.BackendTimeout > 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if cfg.BackendInsecureSkipVerify {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		transport.ResponseHeaderTimeout = cfg.BackendTimeout
+		proxy.Transport = transport
+	}
 
 	// Customize proxy error handling
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// The request body was cut off at max_request_body while streaming it to the backend
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Request body larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// The backend accepted the request but didn't respond within backend_timeout
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			logger.Warnf("[proxy] \033[33m%s %s timed out after %s\033[0m\n", r.Method, r.URL.Path, cfg.BackendTimeout)
+			http.Error(w, fmt.Sprintf("Backend did not respond within %s (backend_timeout)", cfg.BackendTimeout), http.StatusGatewayTimeout)
+			return
+		}
+
 		// Don't log connection errors - they're expected when backend is down
 		w.WriteHeader(http.StatusBadGateway)
 		fmt.Fprintf(w, "Backend temporarily unavailable: %v", err)
 	}
 
-	return &Monitor{
+	m := &Monitor{
 		config:        cfg,
+		backend:       backend,
 		status:        StatusDown,
 		proxy:         proxy,
 		backendURL:    backendURL,
-		reloadClients: make(map[chan string]bool),
+		probe:         TCPProbe(backendURL.Host),
+		upCh:          make(chan struct{}),
+		reloadClients: make(map[<-chan string]reloadClient),
 	}
+
+	// Send requests to the port SetBackendPort found, if it has changed
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.URL.Host = m.target().Host
+	}
+
+	return m
 }
 
 // Start begins health monitoring
@@ -67,17 +184,17 @@ func (m *Monitor) Start(ctx context.Context) {
 	// Initial health check
 	go m.checkHealth()
 
-	// Start periodic health checks
-	m.healthCheckTicker = time.NewTicker(1 * time.Second)
-
+	// Start periodic health checks, jittered so several instances don't all probe at once
 	go func() {
+		timer := time.NewTimer(jitter(healthCheckInterval))
+		defer timer.Stop()
 		for {
 			select {
 			case <-ctx.Done():
-				m.healthCheckTicker.Stop()
 				return
-			case <-m.healthCheckTicker.C:
+			case <-timer.C:
 				m.checkHealth()
+				timer.Reset(jitter(healthCheckInterval))
 			}
 		}
 	}()
@@ -85,41 +202,127 @@ func (m *Monitor) Start(ctx context.Context) {
 
 // checkHealth performs a health check on the backend
 func (m *Monitor) checkHealth() {
-	// Simple TCP connection check (faster than HTTP)
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", m.config.BackendPort), 500*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	m.statusMu.RLock()
+	probe, awaitingPort, resets := m.probe, m.awaitingPort, m.resets
+	m.statusMu.RUnlock()
 
 	newStatus := StatusDown
-	if err == nil {
-		conn.Close()
+	if !awaitingPort && probe(ctx) == nil {
 		newStatus = StatusUp
 	}
 
+	m.statusMu.RLock()
+	stale := m.resets != resets
+	m.statusMu.RUnlock()
+	if stale {
+		return
+	}
+
 	m.updateStatus(newStatus)
 }
 
+// SetProbe replaces the health probe used to check the backend. Must be called before Start.
+func (m *Monitor) SetProbe(probe Probe) {
+	m.probe = probe
+}
+
+// AwaitBackendPort marks the backend's port as unknown, so the backend counts as down until
+// SetBackendPort is called (for backends that pick their port on startup)
+func (m *Monitor) AwaitBackendPort() {
+	m.statusMu.Lock()
+	m.awaitingPort = true
+	m.resets++
+	m.statusMu.Unlock()
+	m.updateStatus(StatusDown)
+}
+
+// MarkDown marks the backend as down until the next health check finds it up, for a
+// backend that was just stopped
+func (m *Monitor) MarkDown() {
+	m.statusMu.Lock()
+	m.resets++
+	m.statusMu.Unlock()
+	m.updateStatus(StatusDown)
+}
+
+// SetBackendPort points the proxy and the health checks at the port the backend listens on
+func (m *Monitor) SetBackendPort(port int) {
+	m.statusMu.Lock()
+	target := *m.backendURL
+	target.Host = net.JoinHostPort(target.Hostname(), strconv.Itoa(port))
+	m.backendURL = &target
+	m.probe = TCPProbe(target.Host)
+	m.awaitingPort = false
+	m.statusMu.Unlock()
+
+	// Don't wait for the next periodic check
+	go m.checkHealth()
+}
+
+// target returns the URL requests to the backend go to
+func (m *Monitor) target() *url.URL {
+	m.statusMu.RLock()
+	defer m.statusMu.RUnlock()
+	return m.backendURL
+}
+
 // updateStatus updates the backend status and notifies listeners
 func (m *Monitor) updateStatus(newStatus Status) {
 	m.statusMu.Lock()
 	oldStatus := m.status
 	m.status = newStatus
+	if newStatus == StatusUp && oldStatus == StatusDown {
+		m.generation++
+		close(m.upCh)
+		m.upCh = make(chan struct{})
+	}
 	m.statusMu.Unlock()
 
 	// Notify on status change
 	if oldStatus != newStatus {
-		logger.Printf("[proxy] Backend status changed: %s -> %s\n",
-			statusString(oldStatus), statusString(newStatus))
+		logger.Printf("[proxy] %s Backend status changed (%s): %s -> %s\n",
+			time.Now().Format("15:04:05"), m.backend.Name, statusString(oldStatus), statusString(newStatus))
 
-		if m.onStatusChange != nil {
-			m.onStatusChange(newStatus)
+		for _, callback := range m.onStatusChange {
+			callback(oldStatus, newStatus)
 		}
 
-		// If backend came online, trigger browser reload
+		// If backend came online, warm it up and trigger browser reload
 		if newStatus == StatusUp && oldStatus == StatusDown {
-			m.triggerReload()
+			if m.config.WarmupPath != "" {
+				go func() {
+					m.warmup()
+					if m.config.ReloadEnabled() {
+						m.triggerReload()
+					}
+				}()
+			} else if m.config.ReloadEnabled() {
+				m.triggerReload()
+			}
 		}
 	}
 }
 
+// warmup requests warmup_path from the backend so its first real request isn't slow.
+// Failures are only logged.
+func (m *Monitor) warmup() {
+	warmupURL := m.target().JoinPath(m.config.WarmupPath)
+	client := &http.Client{Transport: m.proxy.Transport, Timeout: m.config.WarmupTimeout}
+
+	start := time.Now()
+	resp, err := client.Get(warmupURL.String())
+	if err != nil {
+		logger.Warnf("[proxy] \033[33mWarmup request to %s failed: %v\033[0m\n", warmupURL, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	logger.Printf("[proxy] Warmed up %s (%d) in %s\n", warmupURL, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+}
+
 // GetStatus returns the current backend status
 func (m *Monitor) GetStatus() Status {
 	m.statusMu.RLock()
@@ -127,9 +330,41 @@ func (m *Monitor) GetStatus() Status {
 	return m.status
 }
 
-// SetStatusChangeCallback sets a callback for status changes
-func (m *Monitor) SetStatusChangeCallback(callback func(Status)) {
-	m.onStatusChange = callback
+// WaitUntilUp blocks until the backend is up or ctx is done, and reports whether it is up
+func (m *Monitor) WaitUntilUp(ctx context.Context) bool {
+	m.statusMu.RLock()
+	status, upCh := m.status, m.upCh
+	m.statusMu.RUnlock()
+
+	if status == StatusUp {
+		return true
+	}
+
+	select {
+	case <-upCh:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// GetGeneration returns the number of times the backend has come up
+func (m *Monitor) GetGeneration() uint64 {
+	m.statusMu.RLock()
+	defer m.statusMu.RUnlock()
+	return m.generation
+}
+
+// AddStatusChangeCallback adds a callback for status changes, which gets the status before
+// and after the change. Callbacks run on the health check goroutine, so they mustn't block.
+// Must be called before Start.
+func (m *Monitor) AddStatusChangeCallback(callback func(oldStatus, newStatus Status)) {
+	m.onStatusChange = append(m.onStatusChange, callback)
+}
+
+// GetBackend returns the backend this monitor checks
+func (m *Monitor) GetBackend() config.Backend {
+	return m.backend
 }
 
 // GetProxy returns the reverse proxy for the backend
@@ -144,31 +379,71 @@ func (m *Monitor) triggerReload() {
 
 	logger.Printf("[proxy] Triggering browser reload for %d client(s)\n", len(m.reloadClients))
 
-	for client := range m.reloadClients {
+	for _, client := range m.reloadClients {
+		send(client.events, "reload", client.policy)
+	}
+}
+
+// send delivers a message to a client without blocking, applying the drop policy when its buffer is full
+func send(client chan string, msg string, policy DropPolicy) {
+	select {
+	case client <- msg:
+		return
+	default:
+	}
+
+	switch policy {
+	case DropNewest:
+		// Client not ready to receive, skip
+		return
+	case DropOldest:
 		select {
-		case client <- "reload":
+		case <-client:
 		default:
-			// Client not ready to receive, skip
 		}
+	case Coalesce:
+		for len(client) > 0 {
+			select {
+			case <-client:
+			default:
+			}
+		}
+	}
+
+	select {
+	case client <- msg:
+	default:
+		// Another sender refilled the buffer in the meantime
 	}
 }
 
-// AddReloadClient adds a client for auto-reload notifications
-func (m *Monitor) AddReloadClient() <-chan string {
-	client := make(chan string, 1)
+// AddReloadClient adds a client for auto-reload notifications. bufferSize is the number of
+// messages buffered for the client and policy decides what is dropped when that buffer is full.
+// It returns false without adding the client once max_reload_clients are connected.
+func (m *Monitor) AddReloadClient(bufferSize int, policy DropPolicy) (<-chan string, bool) {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
 
 	m.reloadClientsMu.Lock()
-	m.reloadClients[client] = true
-	m.reloadClientsMu.Unlock()
+	defer m.reloadClientsMu.Unlock()
 
-	return client
+	if max := m.config.MaxReloadClients; max > 0 && len(m.reloadClients) >= max {
+		logger.Warnf("[proxy] \033[33mRejected reload client: %d clients already connected to %s (max_reload_clients)\033[0m\n", len(m.reloadClients), m.backend.Name)
+		return nil, false
+	}
+
+	events := make(chan string, bufferSize)
+	m.reloadClients[events] = reloadClient{events: events, policy: policy}
+	return events, true
 }
 
-// RemoveReloadClient removes a client from auto-reload notifications
-func (m *Monitor) RemoveReloadClient(client chan string) {
+// RemoveReloadClient removes a client returned by AddReloadClient from auto-reload notifications
+func (m *Monitor) RemoveReloadClient(client <-chan string) {
 	m.reloadClientsMu.Lock()
+	defer m.reloadClientsMu.Unlock()
+
 	delete(m.reloadClients, client)
-	m.reloadClientsMu.Unlock()
 }
 
 // ForceReload manually triggers a browser reload
@@ -176,6 +451,11 @@ func (m *Monitor) ForceReload() {
 	m.triggerReload()
 }
 
+// String returns a human-readable status string
+func (s Status) String() string {
+	return statusString(s)
+}
+
 // statusString returns a human-readable status string
 func statusString(status Status) string {
 	switch status {
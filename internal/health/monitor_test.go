@@ -0,0 +1,155 @@
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// newTestProxy starts a server proxying to backend through a monitor's reverse proxy
+func newTestProxy(t *testing.T, backend *httptest.Server) *httptest.Server {
+	t.Helper()
+	cfg := &config.Config{FlushInterval: 100 * time.Millisecond}
+	m := NewMonitor(cfg, config.Backend{Name: "default", PathPrefix: "/", URL: backend.URL})
+	proxy := httptest.NewServer(m.GetProxy())
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestProxyForwardsTrailers(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if te := r.Header.Get("Te"); te != "trailers" {
+			t.Errorf("backend got TE %q, want trailers", te)
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc-web")
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+
+		// The client must see the first chunk while the handler is still running
+		<-release
+		io.WriteString(w, "second\n")
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}))
+	defer backend.Close()
+	proxy := newTestProxy(t, backend)
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/service/Method", nil)
+	req.Header.Set("TE", "trailers")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		close(release)
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	first := make(chan string, 1)
+	go func() {
+		line, _ := body.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if line != "first\n" {
+			t.Errorf("first chunk = %q, want %q", line, "first\n")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("first chunk didn't arrive before the backend finished")
+	}
+	close(release)
+
+	rest, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading the body failed: %v", err)
+	}
+	if string(rest) != "second\n" {
+		t.Errorf("rest of the body = %q, want %q", rest, "second\n")
+	}
+
+	// Trailers are only filled in once the body has been read
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("announced trailer Grpc-Status = %q, want 0", got)
+	}
+	if got := resp.Trailer.Get("Grpc-Message"); got != "done" {
+		t.Errorf("late trailer Grpc-Message = %q, want done", got)
+	}
+}
+
+func TestIPv6Backend(t *testing.T) {
+	// A backend listening only on the IPv6 loopback address
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from ::1")
+	}))
+	backend.Listener.Close()
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	path := filepath.Join(t.TempDir(), "godevwatch.yaml")
+	data := fmt.Sprintf("backend_host: \"[::1]\"\nbackend_port: %d\n", port)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := fmt.Sprintf("http://[::1]:%d", port); cfg.Backends[0].URL != want {
+		t.Fatalf("backend url = %q, want %q", cfg.Backends[0].URL, want)
+	}
+
+	m := NewMonitor(cfg, cfg.Backends[0])
+	m.checkHealth()
+	if status := m.GetStatus(); status != StatusUp {
+		t.Errorf("status of the backend = %s, want %s", status, StatusUp)
+	}
+
+	proxy := httptest.NewServer(m.GetProxy())
+	defer proxy.Close()
+	resp, err := http.Get(proxy.URL + "/")
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from ::1" {
+		t.Errorf("proxied response = %d %q, want 200 %q", resp.StatusCode, body, "hello from ::1")
+	}
+}
+
+func TestReloadClientLimit(t *testing.T) {
+	cfg := &config.Config{MaxReloadClients: 2}
+	m := NewMonitor(cfg, config.Backend{Name: "default", PathPrefix: "/", URL: "http://127.0.0.1:1"})
+
+	first, _ := m.AddReloadClient(1, Coalesce)
+	if _, ok := m.AddReloadClient(1, Coalesce); !ok {
+		t.Fatal("second client rejected below max_reload_clients")
+	}
+	if _, ok := m.AddReloadClient(1, Coalesce); ok {
+		t.Fatal("third client accepted beyond max_reload_clients")
+	}
+
+	// A client that disconnects frees its slot
+	m.RemoveReloadClient(first)
+	if _, ok := m.AddReloadClient(1, Coalesce); !ok {
+		t.Error("client rejected after another one disconnected")
+	}
+}
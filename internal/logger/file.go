@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append-only log file that is rotated once it grows past maxSize:
+// build.log becomes build.log.1, build.log.1 becomes build.log.2 and so on, keeping at most
+// keep rotated files
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+// OpenRotatingFile opens (or creates) the log file at path for appending
+func OpenRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the current log file, continuing where it left off
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// Write implements io.Writer, rotating the file first if p would grow it past maxSize
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file
+func (r *RotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+	for i := r.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.keep > 0 {
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+	return r.open()
+}
+
+// Close closes the log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// LogFile is the log file a PrefixWriter copies its output to
+type LogFile int
+
+const (
+	// NoLogFile only writes to the terminal
+	NoLogFile LogFile = iota
+	// BuildLog is for the output of builds, generators, setup commands and hooks
+	BuildLog
+	// BackendLog is for the output of the backend
+	BackendLog
+)
+
+// Log files that build and backend output is copied to, if set
+var logFiles struct {
+	sync.RWMutex
+	build, backend io.WriteCloser
+}
+
+// SetLogFiles copies the output of PrefixWriters for BuildLog to build and for BackendLog
+// to backend, in addition to the terminal. Either may be nil.
+func SetLogFiles(build, backend io.WriteCloser) {
+	logFiles.Lock()
+	defer logFiles.Unlock()
+	logFiles.build, logFiles.backend = build, backend
+}
+
+// CloseLogFiles closes the log files set with SetLogFiles. Output written afterwards only
+// goes to the terminal.
+func CloseLogFiles() {
+	logFiles.Lock()
+	defer logFiles.Unlock()
+	for _, file := range []io.WriteCloser{logFiles.build, logFiles.backend} {
+		if file != nil {
+			file.Close()
+		}
+	}
+	logFiles.build, logFiles.backend = nil, nil
+}
+
+// fileFor returns the log file set for dest, if any
+func fileFor(dest LogFile) io.Writer {
+	logFiles.RLock()
+	defer logFiles.RUnlock()
+
+	switch {
+	case dest == BuildLog && logFiles.build != nil:
+		return logFiles.build
+	case dest == BackendLog && logFiles.backend != nil:
+		return logFiles.backend
+	}
+	return nil
+}
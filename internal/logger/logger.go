@@ -1,24 +1,79 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
-// Global debug mode flag
-var debugMode bool
+// out receives the log output. SetOutput changes it before logging starts.
+var out io.Writer = os.Stdout
+
+// SetOutput sends all further log output to w instead of stdout
+func SetOutput(w io.Writer) {
+	out = w
+}
+
+// Output returns the writer log output goes to, for prefixing command output
+func Output() io.Writer {
+	return out
+}
+
+// Global debug mode flag, toggled at runtime by SIGUSR1
+var debugMode atomic.Bool
 
 // SetDebugMode sets the global debug mode for logging
 func SetDebugMode(debug bool) {
-	debugMode = debug
+	debugMode.Store(debug)
+}
+
+// DebugMode reports whether debug logging is enabled
+func DebugMode() bool {
+	return debugMode.Load()
+}
+
+// Quiet mode only logs errors and warnings; silent mode also hides build and backend output
+var quietMode, silentMode atomic.Bool
+
+// SetQuietMode sets whether only errors and warnings are logged
+func SetQuietMode(quiet bool) {
+	quietMode.Store(quiet)
+}
+
+// QuietMode reports whether only errors and warnings are logged
+func QuietMode() bool {
+	return quietMode.Load()
+}
+
+// SetSilentMode sets whether the output of builds and the backend is hidden as well
+func SetSilentMode(silent bool) {
+	silentMode.Store(silent)
+}
+
+// DefaultMaxLineBuffer is the default longest partial line a PrefixWriter buffers
+const DefaultMaxLineBuffer = 64 * 1024
+
+// maxLineBuffer is the longest partial line a PrefixWriter buffers before flushing it
+var maxLineBuffer atomic.Int64
+
+// SetMaxLineBuffer sets the longest partial line a PrefixWriter buffers before flushing it
+// with a continuation marker (0 or less restores the default)
+func SetMaxLineBuffer(size int) {
+	maxLineBuffer.Store(int64(size))
 }
 
 // ShouldLog determines if a log prefix should be shown based on debug mode
 func ShouldLog(prefix string) bool {
-	if debugMode {
+	if debugMode.Load() {
 		return true // Show all logs in debug mode
 	}
+	if quietMode.Load() {
+		return false // Errors and warnings are logged with Errorf and Warnf
+	}
 
 	// In non-debug mode, only show proxy and backend logs
 	return strings.Contains(prefix, "[proxy]") || strings.Contains(prefix, "[backend]")
@@ -28,7 +83,7 @@ func ShouldLog(prefix string) bool {
 func Printf(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
 	if ShouldLog(msg) {
-		fmt.Print(msg)
+		fmt.Fprint(out, msg)
 	}
 }
 
@@ -36,51 +91,104 @@ func Printf(format string, args ...interface{}) {
 func Println(args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	if ShouldLog(msg) {
-		fmt.Println(msg)
+		fmt.Fprintln(out, msg)
 	}
 }
 
-// PrefixWriter wraps an io.Writer and prefixes each line with a given prefix
+// Infof prints a formatted message regardless of debug mode, unless in quiet mode
+func Infof(format string, args ...interface{}) {
+	if !quietMode.Load() {
+		fmt.Fprintf(out, format, args...)
+	}
+}
+
+// Warnf prints a formatted warning message regardless of debug and quiet mode
+func Warnf(format string, args ...interface{}) {
+	fmt.Fprintf(out, format, args...)
+}
+
+// Errorf prints a formatted error message regardless of debug and quiet mode
+func Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(out, format, args...)
+}
+
+// PrefixWriter wraps an io.Writer and prefixes each line with a given prefix. Output can
+// also be copied to one of the log files set with SetLogFiles, with a timestamp.
 type PrefixWriter struct {
 	prefix string
 	writer io.Writer
+	file   io.Writer
 	buffer []byte
+	onLine func(line string)
 }
 
-// NewPrefixWriter creates a new PrefixWriter
-func NewPrefixWriter(prefix string, writer io.Writer) *PrefixWriter {
+// NewPrefixWriter creates a new PrefixWriter that also copies its output to file
+func NewPrefixWriter(prefix string, writer io.Writer, file LogFile) *PrefixWriter {
 	return &PrefixWriter{
 		prefix: prefix,
 		writer: writer,
+		file:   fileFor(file),
 		buffer: []byte{},
 	}
 }
 
+// SetLineCallback sets a function that sees every complete line (without the prefix),
+// even in silent mode. Must be called before the first Write.
+func (pw *PrefixWriter) SetLineCallback(callback func(line string)) {
+	pw.onLine = callback
+}
+
 // Write implements io.Writer interface
 func (pw *PrefixWriter) Write(p []byte) (n int, err error) {
-	// Add to buffer
-	pw.buffer = append(pw.buffer, p...)
-
-	// Process complete lines
-	lines := strings.Split(string(pw.buffer), "\n")
-
-	// Keep the last incomplete line in buffer
-	if len(lines) > 0 && !strings.HasSuffix(string(pw.buffer), "\n") {
-		pw.buffer = []byte(lines[len(lines)-1])
-		lines = lines[:len(lines)-1]
-	} else {
-		pw.buffer = []byte{}
+	if silentMode.Load() && pw.file == nil && pw.onLine == nil {
+		return len(p), nil
 	}
 
-	// Write prefixed lines
-	for _, line := range lines {
-		if line != "" || strings.HasSuffix(string(p), "\n") {
-			_, err := fmt.Fprintf(pw.writer, "%s%s\n", pw.prefix, line)
-			if err != nil {
-				return len(p), err
+	limit := int(maxLineBuffer.Load())
+	if limit <= 0 {
+		limit = DefaultMaxLineBuffer
+	}
+
+	for data := p; len(data) > 0; {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			// Don't buffer a line without a newline (e.g. progress output) forever: flush it
+			// in chunks of at most limit bytes, each with a continuation marker
+			for len(pw.buffer)+len(data) > limit {
+				take := limit - len(pw.buffer)
+				chunk := string(pw.buffer) + string(data[:take])
+				pw.buffer, data = pw.buffer[:0], data[take:]
+				if err := pw.writeLine(chunk + "…"); err != nil {
+					return len(p), err
+				}
 			}
+			pw.buffer = append(pw.buffer, data...)
+			break
+		}
+
+		// Write the completed line
+		line := string(pw.buffer) + string(data[:end])
+		pw.buffer, data = pw.buffer[:0], data[end+1:]
+		if err := pw.writeLine(line); err != nil {
+			return len(p), err
 		}
 	}
 
 	return len(p), nil
 }
+
+// writeLine writes a prefixed line to the terminal (unless silenced) and the log file
+func (pw *PrefixWriter) writeLine(line string) error {
+	if pw.onLine != nil {
+		pw.onLine(line)
+	}
+	if pw.file != nil {
+		// A failing log file mustn't break the command whose output is logged
+		fmt.Fprintf(pw.file, "%s %s%s\n", time.Now().Format("2006-01-02 15:04:05.000"), pw.prefix, line)
+	}
+	if silentMode.Load() {
+		return nil
+	}
+	_, err := fmt.Fprintf(pw.writer, "%s%s\n", pw.prefix, line)
+	return err
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriterLines(t *testing.T) {
+	var out bytes.Buffer
+	pw := NewPrefixWriter("[build] ", &out, NoLogFile)
+
+	// Lines split across writes are joined, several lines in one write are split
+	for _, chunk := range []string{"first\nsec", "ond", "\nthird\n\n"} {
+		pw.Write([]byte(chunk))
+	}
+
+	want := "[build] first\n[build] second\n[build] third\n[build] \n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestPrefixWriterCapsLineWithoutNewline(t *testing.T) {
+	total := 1024 * 1024
+
+	// A megabyte of progress output without a newline, in one write and in small ones
+	for _, size := range []int{total, 4096} {
+		var out bytes.Buffer
+		pw := NewPrefixWriter("[backend] ", &out, NoLogFile)
+		for written := 0; written < total; written += size {
+			pw.Write(bytes.Repeat([]byte("x"), size))
+			if len(pw.buffer) > DefaultMaxLineBuffer {
+				t.Fatalf("writes of %d bytes: %d bytes buffered, want at most %d", size, len(pw.buffer), DefaultMaxLineBuffer)
+			}
+		}
+
+		// Full chunks are flushed, the last one waits for more output
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if want := total/DefaultMaxLineBuffer - 1; len(lines) != want {
+			t.Errorf("writes of %d bytes: %d lines, want %d", size, len(lines), want)
+		}
+		if len(pw.buffer) != DefaultMaxLineBuffer {
+			t.Errorf("writes of %d bytes: %d bytes buffered, want %d", size, len(pw.buffer), DefaultMaxLineBuffer)
+		}
+		for _, line := range lines {
+			if want := "[backend] " + strings.Repeat("x", DefaultMaxLineBuffer) + "…"; line != want {
+				t.Fatalf("writes of %d bytes: line of %d bytes, want %d ending in …", size, len(line), len(want))
+			}
+		}
+	}
+}
+
+func TestPrefixWriterSetMaxLineBuffer(t *testing.T) {
+	SetMaxLineBuffer(4)
+	defer SetMaxLineBuffer(DefaultMaxLineBuffer)
+
+	var out bytes.Buffer
+	pw := NewPrefixWriter("", &out, NoLogFile)
+	pw.Write([]byte("abcdefghij"))
+	pw.Write([]byte("k\n"))
+
+	want := "abcd…\nefgh…\nijk\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestQuietModeLevels(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetQuietMode(true)
+	defer func() {
+		SetOutput(os.Stdout)
+		SetQuietMode(false)
+	}()
+
+	// Only the level decides, not the wording of the message
+	Printf("[proxy] Failed to frobnicate\n")
+	Infof("[watch] Error count: 0\n")
+	Warnf("[proxy] slow\n")
+	Errorf("[proxy] broken\n")
+
+	if want := "[proxy] slow\n[proxy] broken\n"; buf.String() != want {
+		t.Errorf("quiet output = %q, want %q", buf.String(), want)
+	}
+}
+
+// closeBuffer is a log file that remembers being closed
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestPrefixWriterLogFile(t *testing.T) {
+	buildLog, backendLog := &closeBuffer{}, &closeBuffer{}
+	SetLogFiles(buildLog, backendLog)
+
+	// The destination is chosen by the caller, whatever the prefix
+	var out bytes.Buffer
+	NewPrefixWriter("[generate:templ] ", &out, BuildLog).Write([]byte("generated\n"))
+	NewPrefixWriter("[hook] ", &out, BuildLog).Write([]byte("notified\n"))
+	NewPrefixWriter("[backend] ", &out, BackendLog).Write([]byte("listening\n"))
+	NewPrefixWriter("[build] ", &out, NoLogFile).Write([]byte("terminal only\n"))
+
+	if got := buildLog.String(); !strings.Contains(got, "[generate:templ] generated") || !strings.Contains(got, "[hook] notified") {
+		t.Errorf("build.log = %q, want the generator and hook output", got)
+	}
+	if got := backendLog.String(); !strings.Contains(got, "[backend] listening") || strings.Contains(got, "terminal only") {
+		t.Errorf("backend.log = %q, want only the backend output", got)
+	}
+
+	CloseLogFiles()
+	if !buildLog.closed || !backendLog.closed {
+		t.Error("CloseLogFiles didn't close both log files")
+	}
+	NewPrefixWriter("[build] ", &out, BuildLog).Write([]byte("after close\n"))
+	if strings.Contains(buildLog.String(), "after close") {
+		t.Error("output was copied to a closed log file")
+	}
+}
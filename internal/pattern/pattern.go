@@ -0,0 +1,71 @@
+// Package pattern matches file paths against the glob patterns used in build rules
+package pattern
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match reports whether a relative file path matches a glob pattern. Each path element is
+// matched with the path.Match syntax, and a "**" element matches any number of elements
+// (including none), so "src/**" matches everything below src and "**/vendor/**"
+// everything below a vendor directory at any depth. A directory given with a trailing
+// slash ("vendor/") also matches the patterns of the directory itself.
+func Match(name, pattern string) bool {
+	// Extension filters like "**/*.go" only depend on the file name
+	if ext, ok := Extension(pattern); ok {
+		return strings.HasSuffix(filepath.Base(name), ext)
+	}
+	return match(name, pattern)
+}
+
+// match is Match without the fast path for extension filters
+func match(name, pattern string) bool {
+	name = filepath.ToSlash(name)
+	patternElems := strings.Split(pattern, "/")
+	if matchElems(strings.Split(name, "/"), patternElems) {
+		return true
+	}
+	if dir, ok := strings.CutSuffix(name, "/"); ok && dir != "" {
+		return matchElems(strings.Split(dir, "/"), patternElems)
+	}
+	return false
+}
+
+// matchElems matches path elements against pattern elements
+func matchElems(elems, patternElems []string) bool {
+	for len(patternElems) > 0 {
+		if patternElems[0] == "**" {
+			// Skip repeated "**" elements, then let the rest match any tail of the path
+			for len(patternElems) > 0 && patternElems[0] == "**" {
+				patternElems = patternElems[1:]
+			}
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(elems[i:], patternElems) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+		if matched, err := path.Match(patternElems[0], elems[0]); err != nil || !matched {
+			return false
+		}
+		elems, patternElems = elems[1:], patternElems[1:]
+	}
+	return len(elems) == 0
+}
+
+// Extension returns the extension of a "**/*.ext" pattern. Such a pattern matches every
+// file name ending in the extension, in any directory, so a suffix check is enough.
+func Extension(pattern string) (string, bool) {
+	ext, ok := strings.CutPrefix(pattern, "**/*")
+	if !ok || !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext, "*?[\\/") {
+		return "", false
+	}
+	return ext, true
+}
@@ -0,0 +1,136 @@
+package pattern
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// Patterns of the default config
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/root.go", true},
+		{"**/*.go", "internal/watcher/watcher.go", true},
+		{"**/*.go", "main.go.orig", false},
+		{"**/*.go", "README.md", false},
+		{"**/*_test.go", "internal/pattern/pattern_test.go", true},
+		{"**/*_test.go", "internal/pattern/pattern.go", false},
+		{"**/*.templ", "views/home.templ", true},
+		{"**/*.templ", "views/home_templ.go", false},
+		{"tmp/**", "tmp/main", true},
+		{"tmp/**", "tmp/.build-status/current-status", true},
+		{"tmp/**", "tmp", true},
+		{"tmp/**", "tmp/", true},
+		{"tmp/**", "tmpl/index.html", false},
+		{"tmp/**", "web/tmp/main", false},
+		{"vendor/**", "vendor/github.com/spf13/cobra/command.go", true},
+		{"vendor/**", "vendor/", true},
+		{"node_modules/**", "node_modules/react/index.js", true},
+		{"node_modules/**", "web/node_modules/react/index.js", false},
+
+		// Several "**" elements
+		{"**/node_modules/**", "node_modules/react/index.js", true},
+		{"**/node_modules/**", "web/node_modules/react/index.js", true},
+		{"**/node_modules/**", "web/src/index.js", false},
+		{"**/vendor/**", "services/api/vendor/", true},
+		{"a/**/b/**/*.go", "a/b/c.go", true},
+		{"a/**/b/**/*.go", "a/x/b/y/z.go", true},
+		{"a/**/b/**/*.go", "a/x/c.go", false},
+		{"a/**/b/**/*.go", "a/b/c.js", false},
+		{"**/**/*.go", "main.go", true},
+		{"src/**/test/*.go", "src/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/test/a.go", true},
+		{"src/**/test/*.go", "src/x/test/y/a.go", false},
+		{"**", "any/path/at/all.txt", true},
+
+		// Patterns without "**"
+		{"go.mod", "go.mod", true},
+		{"go.mod", "tools/go.mod", false},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/*/main.go", "cmd/server/main.go", true},
+		{"cmd/*/main.go", "cmd/server/app/main.go", false},
+		{"[ab].go", "a.go", true},
+		{"?.go", "ab.go", false},
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.name, tt.pattern); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.name, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		pattern string
+		ext     string
+		ok      bool
+	}{
+		{"**/*.go", ".go", true},
+		{"**/*_test.go", "", false},
+		{"**/*.tar.gz", ".tar.gz", true},
+		{"**/*.go*", "", false},
+		{"**/*.[ch]", "", false},
+		{"src/**/*.go", "", false},
+		{"*.go", "", false},
+	}
+
+	for _, tt := range tests {
+		ext, ok := Extension(tt.pattern)
+		if ext != tt.ext || ok != tt.ok {
+			t.Errorf("Extension(%q) = %q, %v, want %q, %v", tt.pattern, ext, ok, tt.ext, tt.ok)
+		}
+	}
+}
+
+// TestExtensionFastPath checks that the suffix check for "**/*.ext" patterns agrees with the
+// general matcher
+func TestExtensionFastPath(t *testing.T) {
+	patterns := []string{"**/*.go", "**/*.templ", "**/*.tar.gz"}
+	names := []string{
+		"main.go", "cmd/root.go", "a/b/c/d.go", ".go", "main.go.orig", "main.golang",
+		"go", "dir.go/", "views/home.templ", "dist/app.tar.gz", "dist/app.gz", "README.md",
+	}
+
+	for _, p := range patterns {
+		if _, ok := Extension(p); !ok {
+			t.Fatalf("%q is not an extension filter", p)
+		}
+		for _, name := range names {
+			if fast, general := Match(name, p), match(name, p); fast != general {
+				t.Errorf("%q against %q: fast path %v, general matcher %v", name, p, fast, general)
+			}
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		pattern string
+		path    string
+	}{
+		{"extension", "**/*.go", "internal/watcher/watcher.go"},
+		{"prefix", "tmp/**", "tmp/.build-status/current-status"},
+		{"nested", "**/node_modules/**", "web/app/node_modules/react/index.js"},
+		{"multi", "a/**/b/**/*.go", "a/x/y/b/z/main.go"},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				Match(bm.path, bm.pattern)
+			}
+		})
+	}
+
+	// The general matcher on an extension filter, for comparison with the fast path
+	b.Run("extension-general", func(b *testing.B) {
+		for b.Loop() {
+			match("internal/watcher/watcher.go", "**/*.go")
+		}
+	})
+}
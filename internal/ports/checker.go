@@ -28,3 +28,15 @@ func WaitForAvailable(port int, timeout time.Duration) error {
 	}
 	return fmt.Errorf("timeout waiting for port %d", port)
 }
+
+// WaitUntilFree waits for a port to be released (used after stopping a server)
+func WaitUntilFree(port int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if IsAvailable(port) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for port %d to be free", port)
+}
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// RunHook runs a hook command in the background, with env ("KEY=value") added to its
+// environment. Failures are logged and otherwise ignored.
+func RunHook(name, command string, env ...string) {
+	go func() {
+		logger.Printf("[hook] Running %s: %s\n", name, command)
+
+		cmd := exec.Command("sh", "-c", command)
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		cmd.Stdout = logger.NewPrefixWriter("[hook] ", os.Stdout, logger.BuildLog)
+		cmd.Stderr = logger.NewPrefixWriter("[hook] ", os.Stderr, logger.BuildLog)
+
+		if err := cmd.Run(); err != nil {
+			logger.Warnf("[hook] \033[33m%s failed: %v\033[0m\n", name, err)
+		}
+	}()
+}
+
+// RunHookWait runs a hook command and waits for it, killing it along with its children
+// after timeout. Failures are logged and otherwise ignored.
+func RunHookWait(name, command string, timeout time.Duration) {
+	logger.Printf("[hook] Running %s: %s\n", name, command)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = logger.NewPrefixWriter("[hook] ", os.Stdout, logger.BuildLog)
+	cmd.Stderr = logger.NewPrefixWriter("[hook] ", os.Stderr, logger.BuildLog)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		logger.Warnf("[hook] \033[33m%s timed out after %s\033[0m\n", name, timeout)
+	case err != nil:
+		logger.Warnf("[hook] \033[33m%s failed: %v\033[0m\n", name, err)
+	}
+}
@@ -4,18 +4,139 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/kyco/godevwatch/internal/config"
 	"github.com/kyco/godevwatch/internal/logger"
+	"github.com/kyco/godevwatch/internal/ports"
 )
 
+const (
+	// startAttempts is how often StartWithRetry tries to start the application
+	startAttempts = 3
+	// startBackoff is the delay before the first retry, doubled for each further retry
+	startBackoff = 500 * time.Millisecond
+	// startGrace is how long StartWithRetry watches a started application for an early
+	// failure, such as not being able to listen on a port that is still taken
+	startGrace = 500 * time.Millisecond
+)
+
+// Setup runs the one-time setup commands in order, stopping at the first failure
+func Setup(cfg *config.Config) error {
+	for _, setupCmd := range cfg.SetupCmds {
+		logger.Printf("[setup] Running: %s\n", setupCmd)
+
+		cmd := exec.Command("sh", "-c", setupCmd)
+		cmd.Stdout = logger.NewPrefixWriter("[setup] ", logger.Output(), logger.BuildLog)
+		cmd.Stderr = logger.NewPrefixWriter("[setup] ", os.Stderr, logger.BuildLog)
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("setup command failed (%s): %w", setupCmd, err)
+		}
+
+		logger.Printf("[setup] ✓ Completed: %s\n", setupCmd)
+	}
+
+	return nil
+}
+
+// Process is an application started by Start
+type Process struct {
+	cmd      *exec.Cmd
+	done     chan struct{} // Closed once the process has exited
+	stopping atomic.Bool   // Set by Stop so the exit isn't reported as a crash
+	port     chan int      // Receives the port found with backend_port_pattern
+}
+
+// Pid returns the process ID
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Done returns a channel that is closed once the process has exited
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Port returns a channel that receives the port the application reports it listens on,
+// the first time a line of its output matches backend_port_pattern
+func (p *Process) Port() <-chan int {
+	return p.port
+}
+
+// watchForPort reports the port captured by pattern's first group in the first matching line
+func (p *Process) watchForPort(pattern *regexp.Regexp) func(line string) {
+	var found atomic.Bool
+	return func(line string) {
+		if found.Load() {
+			return
+		}
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+		port, err := strconv.Atoi(match[1])
+		if err != nil || port <= 0 || port > 65535 {
+			return
+		}
+		if found.CompareAndSwap(false, true) {
+			p.port <- port
+		}
+	}
+}
+
+// wait reaps the process and reports an exit that Stop didn't cause
+func (p *Process) wait() {
+	err := p.cmd.Wait()
+	close(p.done)
+
+	if p.stopping.Load() {
+		return
+	}
+
+	state := p.cmd.ProcessState
+	switch {
+	case state == nil:
+		logger.Errorf("[backend] \033[31mprocess exited: %v\033[0m\n", err)
+	case state.ExitCode() == 0:
+		logger.Warnf("[backend] \033[33mprocess exited with code 0\033[0m\n")
+	case state.ExitCode() > 128 && state.ExitCode() < 160:
+		// The shell running run_cmd reports a child killed by a signal as 128+signal
+		logger.Errorf("[backend] \033[31mprocess exited with code %d (killed by signal: %s)\033[0m\n",
+			state.ExitCode(), syscall.Signal(state.ExitCode()-128))
+	case state.ExitCode() > 0:
+		logger.Errorf("[backend] \033[31mprocess exited with code %d\033[0m\n", state.ExitCode())
+	default:
+		logger.Errorf("[backend] \033[31mprocess was terminated (%s)\033[0m\n", state)
+	}
+}
+
 // Start executes the run command and keeps it running in the background
-func Start(cfg *config.Config) (*exec.Cmd, error) {
-	logger.Printf("[backend] Starting application: %s\n", cfg.RunCmd)
+func Start(cfg *config.Config) (*Process, error) {
+	runCmd, err := cfg.RunCommand()
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("[backend] Starting application: %s\n", runCmd)
+
+	p := &Process{done: make(chan struct{}), port: make(chan int, 1)}
 
-	cmd := exec.Command("sh", "-c", cfg.RunCmd)
-	cmd.Stdout = logger.NewPrefixWriter("[backend] ", os.Stdout)
-	cmd.Stderr = logger.NewPrefixWriter("[backend] ", os.Stderr)
+	cmd := exec.Command("sh", "-c", runCmd)
+	stdout := logger.NewPrefixWriter("[backend] ", os.Stdout, logger.BackendLog)
+	stderr := logger.NewPrefixWriter("[backend] ", os.Stderr, logger.BackendLog)
+	if cfg.BackendPortPattern != "" {
+		// config.Load has validated the pattern
+		watch := p.watchForPort(regexp.MustCompile(cfg.BackendPortPattern))
+		stdout.SetLineCallback(watch)
+		stderr.SetLineCallback(watch)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
 
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start application: %w", err)
@@ -23,5 +144,66 @@ func Start(cfg *config.Config) (*exec.Cmd, error) {
 
 	logger.Printf("[backend] ✓ Application started (PID: %d)\n", cmd.Process.Pid)
 
-	return cmd, nil
+	p.cmd = cmd
+	go p.wait()
+	return p, nil
+}
+
+// exitedEarly waits up to grace for the process to fail and returns an error if it exits
+// with a non-zero status within that time
+func (p *Process) exitedEarly(grace time.Duration) error {
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		return nil
+	}
+
+	state := p.cmd.ProcessState
+	if state != nil && state.ExitCode() == 0 {
+		return nil
+	}
+	return fmt.Errorf("application exited right after starting (%v)", state)
+}
+
+// StartWithRetry starts the application, retrying with a backoff if it fails to start or
+// exits with an error right away. Between attempts it waits for the backend port to be
+// released by a previous instance.
+func StartWithRetry(cfg *config.Config) (*Process, error) {
+	backoff := startBackoff
+	var err error
+
+	for attempt := 1; attempt <= startAttempts; attempt++ {
+		var p *Process
+		if p, err = Start(cfg); err == nil {
+			if err = p.exitedEarly(startGrace); err == nil {
+				return p, nil
+			}
+		}
+		if attempt == startAttempts {
+			break
+		}
+
+		logger.Warnf("[backend] Start attempt %d/%d failed: %v (retrying in %s)\n", attempt, startAttempts, err, backoff)
+		if err := ports.WaitUntilFree(cfg.BackendPort, backoff); err != nil {
+			logger.Printf("[backend] Port %d is still in use\n", cfg.BackendPort)
+		} else {
+			time.Sleep(backoff)
+		}
+		backoff *= 2
+	}
+
+	return nil, err
+}
+
+// Stop kills the application along with any child processes it spawned and waits for it to exit
+func Stop(p *Process) {
+	if p == nil {
+		return
+	}
+
+	p.stopping.Store(true)
+	if err := killProcessGroup(p.cmd); err != nil {
+		p.cmd.Process.Kill()
+	}
+	<-p.done
 }
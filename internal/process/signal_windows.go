@@ -0,0 +1,13 @@
+//go:build windows
+
+package process
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command's process
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
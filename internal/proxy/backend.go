@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/health"
+	"github.com/kyco/godevwatch/internal/logger"
+	"github.com/kyco/godevwatch/internal/process"
+)
+
+// backend manages the lifecycle of the backend application process
+type backend struct {
+	config  *config.Config
+	store   *build.Store
+	monitor *health.Monitor // Health monitor of the backend run_cmd starts
+
+	mu           sync.Mutex
+	proc         *process.Process
+	restartTimer *time.Timer
+	stopped      bool // Shutting down, nothing may start the backend again
+
+	// Idle tracking: the backend is stopped after idle_timeout without requests
+	idle         bool
+	lastActivity time.Time
+	rebuild      func() // Rebuilds all rules when waking up after builds failed
+}
+
+// newBackend creates a backend manager for the configured run command, which serves the
+// backend monitor checks
+func newBackend(cfg *config.Config, store *build.Store, monitor *health.Monitor) *backend {
+	return &backend{config: cfg, store: store, monitor: monitor, lastActivity: time.Now()}
+}
+
+// setRebuild sets how the backend rebuilds all rules when it wakes up after builds failed
+func (b *backend) setRebuild(rebuild func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rebuild = rebuild
+}
+
+// start starts the backend for the first time, retrying if it fails to start
+func (b *backend) start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	proc, err := b.startProcess(process.StartWithRetry)
+	if err != nil {
+		return err
+	}
+	b.proc = proc
+	return nil
+}
+
+// restart stops the current backend (if any) and starts a new one, and reports whether
+// a new one was started
+func (b *backend) restart() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A delayed restart may fire after shutdown started
+	if b.stopped {
+		return false
+	}
+
+	// An idle backend picks up the new build when it is woken up
+	if b.idle {
+		logger.Printf("[proxy] Backend is idle, it will start with the new build on the next request\n")
+		return false
+	}
+
+	// Kill existing backend if running, so the monitor doesn't take it for the new one
+	if b.proc != nil {
+		logger.Printf("[proxy] Stopping existing backend...\n")
+		process.Stop(b.proc)
+		b.proc = nil
+		b.monitor.MarkDown()
+	}
+
+	// Start new backend
+	proc, err := b.startProcess(process.Start)
+	if err != nil {
+		logger.Errorf("[proxy] \033[31mFailed to start backend: %v\033[0m\n", err)
+		return false
+	}
+
+	b.proc = proc
+	logger.Printf("[proxy] \033[32mBackend started successfully\033[0m\n")
+	// Monitor will detect the new backend and trigger reload automatically
+	return true
+}
+
+// scheduleRestart restarts the backend once no further restart has been requested for
+// the configured restart_debounce, collapsing bursts of successful builds into one restart
+func (b *backend) scheduleRestart() {
+	if b.config.RestartDebounce <= 0 {
+		b.restart()
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		return
+	}
+	if b.restartTimer != nil {
+		b.restartTimer.Stop()
+	}
+	b.restartTimer = time.AfterFunc(b.config.RestartDebounce, func() { b.restart() })
+}
+
+// stop kills the backend and cancels any pending restart. The backend isn't started again
+// afterwards.
+func (b *backend) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stopped = true
+	if b.restartTimer != nil {
+		b.restartTimer.Stop()
+	}
+
+	if b.proc != nil {
+		logger.Println("[proxy] Stopping backend application...")
+		process.Stop(b.proc)
+		b.proc = nil
+	}
+}
+
+// touch records request activity. If the backend was stopped for being idle it is started
+// again, and touch reports true so the caller can hold the request until it is ready. If
+// the latest build of a rule failed, all rules are rebuilt first and the backend starts
+// once they succeed.
+func (b *backend) touch() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastActivity = time.Now()
+	if !b.idle || b.stopped {
+		return false
+	}
+	b.idle = false
+
+	if failed := b.store.FailedRules(); len(failed) > 0 && b.rebuild != nil {
+		logger.Printf("[proxy] Request received, rebuilding %s before waking up backend...\n", strings.Join(failed, ", "))
+		// The build success callback restarts the backend, which needs the lock
+		go b.rebuild()
+		return true
+	}
+
+	logger.Printf("[proxy] Request received, waking up backend...\n")
+	proc, err := b.startProcess(process.Start)
+	if err != nil {
+		logger.Errorf("[proxy] \033[31mFailed to start backend: %v\033[0m\n", err)
+		return false
+	}
+	b.proc = proc
+	return true
+}
+
+// watchIdle stops the backend once no request has been proxied for idle_timeout
+func (b *backend) watchIdle(done <-chan struct{}) {
+	interval := b.config.IdleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			if !b.idle && !b.stopped && b.proc != nil && time.Since(b.lastActivity) >= b.config.IdleTimeout {
+				logger.Printf("[proxy] No requests for %s, stopping idle backend\n", b.config.IdleTimeout)
+				process.Stop(b.proc)
+				b.proc = nil
+				b.idle = true
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// startProcess starts the backend with start. With backend_port_pattern, the backend
+// counts as down until its output shows the port it listens on.
+func (b *backend) startProcess(start func(*config.Config) (*process.Process, error)) (*process.Process, error) {
+	if b.config.BackendPortPattern == "" {
+		return start(b.config)
+	}
+
+	b.monitor.AwaitBackendPort()
+	proc, err := start(b.config)
+	if err != nil {
+		return nil, err
+	}
+	go b.discoverPort(proc)
+	return proc, nil
+}
+
+// discoverPort points the monitor at the port proc reports, or at backend_port if it
+// doesn't report one within backend_port_timeout
+func (b *backend) discoverPort(proc *process.Process) {
+	timer := time.NewTimer(b.config.BackendPortTimeout)
+	defer timer.Stop()
+
+	select {
+	case port := <-proc.Port():
+		logger.Printf("[proxy] Backend reported port %d\n", port)
+		b.monitor.SetBackendPort(port)
+	case <-timer.C:
+		logger.Warnf("[proxy] \033[33mNo line of the backend's output matched backend_port_pattern within %s, using port %d\033[0m\n",
+			b.config.BackendPortTimeout, b.config.BackendPort)
+		b.monitor.SetBackendPort(b.config.BackendPort)
+	case <-proc.Done():
+		// Stopped or crashed before reporting a port; the next start looks again
+	}
+}
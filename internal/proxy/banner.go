@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// printBanner prints a summary of the effective configuration (after defaults are applied)
+func printBanner(cfg *config.Config) {
+	bold, reset := "\033[1m", "\033[0m"
+	if !isTerminal(os.Stdout) {
+		bold, reset = "", ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sgodevwatch%s\n", bold, reset)
+	fmt.Fprintf(&b, "  Config:   %s\n", cfg.Path)
+	fmt.Fprintf(&b, "  Proxy:    %s\n", cfg.ProxyURL())
+	if cfg.ExposesProxy() {
+		for _, url := range lanURLs(cfg.ProxyPort) {
+			fmt.Fprintf(&b, "  Network:  %s\n", url)
+		}
+	}
+	for _, backend := range cfg.Backends {
+		fmt.Fprintf(&b, "  Backend:  %s -> %s (%s)\n", backend.PathPrefix, backend.URL, backend.Name)
+	}
+	if cfg.ExternalBackend() {
+		fmt.Fprintf(&b, "  Run:      external (not managed by godevwatch)\n")
+	} else {
+		fmt.Fprintf(&b, "  Run:      %s (mode: %s)\n", cfg.RunCmd, cfg.RunMode)
+	}
+	fmt.Fprintf(&b, "  Rules:    %d\n", len(cfg.BuildRules))
+	for _, rule := range cfg.BuildRules {
+		fmt.Fprintf(&b, "    - %s (%d watch pattern(s), %d file(s), %d ignore pattern(s))\n",
+			rule.Name, len(rule.Watch), len(rule.Files), len(rule.Ignore))
+	}
+	if cfg.KeepStatus {
+		fmt.Fprintf(&b, "  Status:   %s (kept on shutdown)\n", cfg.BuildStatusDir)
+	} else {
+		fmt.Fprintf(&b, "  Status:   %s\n", cfg.BuildStatusDir)
+	}
+	fmt.Fprintf(&b, "  Reload:   %s\n", onOff(cfg.ReloadEnabled()))
+	fmt.Fprintf(&b, "  Debug:    %s\n", onOff(cfg.DebugMode))
+
+	fmt.Println(b.String())
+}
+
+// lanURLs returns the proxy's URLs on this machine's network interfaces, for opening it
+// from other devices
+func lanURLs(port int) []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var urls []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		urls = append(urls, "http://"+net.JoinHostPort(ipNet.IP.String(), strconv.Itoa(port)))
+	}
+	return urls
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// onOff formats a boolean setting
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
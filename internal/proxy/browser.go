@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// openBrowser opens url in the default browser. It stays quiet when there is no way to
+// open one (e.g. in CI or over SSH).
+func openBrowser(url string) {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		name, args = "rundll32", []string{"url.dll,FileProtocolHandler"}
+	default:
+		name = "xdg-open"
+	}
+
+	if _, err := exec.LookPath(name); err != nil {
+		return
+	}
+	if err := exec.Command(name, append(args, url)...).Start(); err != nil {
+		logger.Warnf("[proxy] Failed to open browser: %v\n", err)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/health"
+)
+
+// requestHold holds proxied requests while the backend is expected back shortly,
+// instead of serving the down page straight away
+type requestHold struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// extend holds requests for at least d from now
+func (h *requestHold) extend(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(h.until) {
+		h.until = until
+	}
+}
+
+// deadline returns when the current hold ends, and whether a hold is active
+func (h *requestHold) deadline() (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.until, time.Now().Before(h.until)
+}
+
+// waitForBackend blocks a request until the backend is up or the hold ends.
+// Streaming (SSE) requests are never held.
+func (h *requestHold) waitForBackend(r *http.Request, monitor *health.Monitor) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return false
+	}
+
+	until, active := h.deadline()
+	if !active {
+		return false
+	}
+
+	ctx, cancel := context.WithDeadline(r.Context(), until)
+	defer cancel()
+	return monitor.WaitUntilUp(ctx)
+}
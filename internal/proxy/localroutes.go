@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// localRoute is a local_routes entry: requests to its path are served by godevwatch
+type localRoute struct {
+	path    string // Exact path, or prefix ending in / when prefix is set
+	prefix  bool
+	handler http.Handler
+}
+
+// localRoutes serves the configured local_routes, exact paths before prefixes and longer
+// prefixes first
+type localRoutes []localRoute
+
+// newLocalRoutes creates the handlers of cfg.LocalRoutes (config.Load has validated them)
+func newLocalRoutes(cfg *config.Config, store *build.Store) localRoutes {
+	var routes localRoutes
+	for path, target := range cfg.LocalRoutes {
+		route := localRoute{path: path}
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			route.path, route.prefix = prefix, true
+		}
+		route.handler = localHandler(route, target, store)
+		routes = append(routes, route)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].prefix != routes[j].prefix {
+			return !routes[i].prefix
+		}
+		return len(routes[i].path) > len(routes[j].path)
+	})
+	return routes
+}
+
+// match returns the handler of the local route serving path, if there is one
+func (routes localRoutes) match(path string) (http.Handler, bool) {
+	for _, route := range routes {
+		if path == route.path || route.prefix && strings.HasPrefix(path, route.path) {
+			return route.handler, true
+		}
+	}
+	return nil, false
+}
+
+// localHandler returns the handler for a route's target: a built-in handler, a directory
+// whose files are served below the route's prefix, or a single file. Files are read on
+// every request, so edits show up without a restart.
+func localHandler(route localRoute, target string, store *build.Store) http.Handler {
+	if name, ok := strings.CutPrefix(target, "builtin:"); ok {
+		return builtinHandler(name, store)
+	}
+
+	if info, err := os.Stat(target); err == nil && info.IsDir() && route.prefix {
+		return http.StripPrefix(route.path, http.FileServer(http.Dir(target)))
+	}
+
+	// http.ServeFile sets the content type from the extension (or by sniffing the content)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, target)
+	})
+}
+
+// builtinHandler returns one of config.LocalRouteBuiltins
+func builtinHandler(name string, store *build.Store) http.Handler {
+	switch name {
+	case "no-content":
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	case "build-status":
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(store.CurrentStatus())
+		})
+	default:
+		return http.NotFoundHandler()
+	}
+}
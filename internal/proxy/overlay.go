@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/health"
+)
+
+//go:embed templates/building-overlay.html
+var buildingOverlay string
+
+// maxOverlayBody is the largest HTML response the building overlay is injected into
+const maxOverlayBody = 10 << 20
+
+// overlayInjector returns a ModifyResponse hook that adds the building overlay to the HTML
+// pages of monitor's backend. The overlay shows while a rebuild runs and hides once the new
+// backend is up. Compressed and very large responses are passed through untouched.
+func overlayInjector(cfg *config.Config, store *build.Store, monitor *health.Monitor) func(*http.Response) error {
+	name, _ := json.Marshal(monitor.GetBackend().Name)
+	snippet := strings.ReplaceAll(buildingOverlay, "/__", cfg.InternalPath(""))
+	snippet = strings.Replace(snippet, "{{BACKEND}}", string(name), 1)
+
+	return func(resp *http.Response) error {
+		if resp.Request.Method == http.MethodHead ||
+			!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") ||
+			(resp.Header.Get("Content-Encoding") != "" && resp.Header.Get("Content-Encoding") != "identity") ||
+			resp.ContentLength > maxOverlayBody {
+			return nil
+		}
+
+		// Responses without a length are only known to be small enough once read
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxOverlayBody+1))
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+		if len(body) > maxOverlayBody {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return nil
+		}
+		resp.Body.Close()
+
+		overlay := strings.Replace(snippet, "{{BUILDING}}", strconv.FormatBool(store.CurrentStatus().Building), 1)
+		body = injectBeforeBodyEnd(body, []byte(overlay))
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		resp.Header.Del("Transfer-Encoding")
+		return nil
+	}
+}
+
+// injectBeforeBodyEnd inserts snippet before the last </body> tag, or appends it to pages
+// without one
+func injectBeforeBodyEnd(page, snippet []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(page, snippet...)
+	}
+	result := make([]byte, 0, len(page)+len(snippet))
+	result = append(result, page[:i]...)
+	result = append(result, snippet...)
+	return append(result, page[i:]...)
+}
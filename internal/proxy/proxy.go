@@ -5,15 +5,17 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
-	"io/fs"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/kyco/godevwatch/internal/build"
 	"github.com/kyco/godevwatch/internal/config"
@@ -26,104 +28,155 @@ import (
 //go:embed templates/server-down.html
 var serverDownPage string
 
-// BuildStatusResponse represents the current build status
-type BuildStatusResponse struct {
-	CurrentBuild *BuildInfo `json:"current_build,omitempty"`
+// rerunReadyTimeout is how long a rerun backend may take to compile and bind its port
+const rerunReadyTimeout = 2 * time.Minute
+
+// statusSnapshot is sent to reload clients when they connect
+type statusSnapshot struct {
+	Backend      string             `json:"backend"`
+	Building     bool               `json:"building"`
+	CurrentBuild *build.BuildRecord `json:"current_build,omitempty"`
 }
 
-// BuildInfo represents information about a build
-type BuildInfo struct {
-	BuildID   string `json:"build_id"`
-	RuleName  string `json:"rule_name"`
-	Status    string `json:"status"`
-	Timestamp int64  `json:"timestamp"`
+// writeEvent writes a Server-Sent Event and flushes it to the client.
+// An empty event name sends a plain message.
+func writeEvent(w http.ResponseWriter, event, data string) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
-// getCurrentBuildStatus reads the current build status from the build directory
-func getCurrentBuildStatus(cfg *config.Config) string {
-	buildStatusDir := cfg.BuildStatusDir
+// SetupLogging applies the debug flag, log_level and log_dir to the logger. Call
+// logger.CloseLogFiles when done.
+func SetupLogging(cfg *config.Config) {
+	logger.SetDebugMode(cfg.DebugMode)
+	logger.SetQuietMode(cfg.LogLevel == config.LogLevelError || cfg.LogLevel == config.LogLevelSilent)
+	logger.SetSilentMode(cfg.LogLevel == config.LogLevelSilent)
+	logger.SetMaxLineBuffer(cfg.MaxLineBuffer)
 
-	// Check if build status directory exists
-	if _, err := os.Stat(buildStatusDir); os.IsNotExist(err) {
-		response := BuildStatusResponse{}
-		data, _ := json.Marshal(response)
-		return string(data)
+	if cfg.LogDir != "" {
+		if err := openLogFiles(cfg); err != nil {
+			logger.Warnf("[proxy] \033[33mWarning: failed to open log files in %s: %v\033[0m\n", cfg.LogDir, err)
+		}
 	}
+}
 
-	// Find the most recent build status file
-	var currentBuild *BuildInfo
+// handleInternal registers the handler of one of config.InternalEndpoints on mux
+func handleInternal(mux *http.ServeMux, cfg *config.Config, name string, handler http.HandlerFunc) {
+	if !slices.Contains(config.InternalEndpoints, name) {
+		panic(fmt.Sprintf("endpoint %q is missing from config.InternalEndpoints", name))
+	}
+	mux.HandleFunc(cfg.InternalPath(name), handler)
+}
 
-	filepath.WalkDir(buildStatusDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
-		}
+// openLogFiles starts copying build and backend output to build.log and backend.log in log_dir
+func openLogFiles(cfg *config.Config) error {
+	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
+		return err
+	}
+	buildLog, err := logger.OpenRotatingFile(filepath.Join(cfg.LogDir, "build.log"), cfg.LogMaxSize, cfg.LogMaxFiles)
+	if err != nil {
+		return err
+	}
+	backendLog, err := logger.OpenRotatingFile(filepath.Join(cfg.LogDir, "backend.log"), cfg.LogMaxSize, cfg.LogMaxFiles)
+	if err != nil {
+		buildLog.Close()
+		return err
+	}
+	logger.SetLogFiles(buildLog, backendLog)
+	return nil
+}
 
-		filename := d.Name()
+// Start initializes and starts the proxy server
+func Start(cfg *config.Config) error {
+	SetupLogging(cfg)
+	defer logger.CloseLogFiles()
 
-		// Parse build status files (format: timestamp-buildid-status)
-		parts := strings.Split(filename, "-")
-		if len(parts) >= 3 {
-			// Skip current-build-id and last-success-build-id files
-			if strings.HasPrefix(filename, "current-build-id") || strings.HasPrefix(filename, "last-success-build-id") {
-				return nil
-			}
+	// Summarize what we're about to do
+	if !logger.QuietMode() {
+		printBanner(cfg)
+	}
 
-			timestampStr := parts[0]
-			buildID := parts[1]
-			status := strings.Join(parts[2:], "-")
+	// Prepare the environment once before anything else
+	if err := process.Setup(cfg); err != nil {
+		return err
+	}
 
-			// Convert timestamp string to int64
-			timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-			if err != nil {
-				return nil // Skip invalid timestamp
-			}
+	// Create health monitors (one per backend) and build status store
+	backends := newRoutes(cfg)
+	store := build.NewStore()
+	if err := build.PersistHistory(cfg, store); err != nil {
+		logger.Warnf("[proxy] Warning: failed to open build history: %v\n", err)
+	}
 
-			// Only keep the most recent build (or if this is the current one)
-			if currentBuild == nil || timestamp > currentBuild.Timestamp {
-				currentBuild = &BuildInfo{
-					BuildID:   buildID,
-					RuleName:  "go-build", // Default rule name
-					Status:    status,
-					Timestamp: timestamp,
-				}
-			}
+	// Show a banner on the backend's pages while rebuilding
+	if cfg.BuildingOverlay && cfg.ReloadEnabled() {
+		for _, monitor := range backends.monitors {
+			monitor.GetProxy().ModifyResponse = overlayInjector(cfg, store, monitor)
 		}
+	}
 
-		return nil
-	})
+	// Point the down page at the configured internal endpoints
+	downPage := strings.ReplaceAll(serverDownPage, "/__", cfg.InternalPath(""))
+	downPage = strings.Replace(downPage, "{{RELOAD_ENABLED}}", strconv.FormatBool(cfg.ReloadEnabled()), 1)
 
-	response := BuildStatusResponse{
-		CurrentBuild: currentBuild,
+	// Requests held while the backend restarts, and while it starts for the first time
+	hold := &requestHold{}
+	if cfg.StartupHold > 0 {
+		hold.extend(cfg.StartupHold)
 	}
 
-	data, _ := json.Marshal(response)
-	return string(data)
-}
-
-// Start initializes and starts the proxy server
-func Start(cfg *config.Config) error {
-	// Set global debug mode for logging
-	logger.SetDebugMode(cfg.DebugMode)
+	// Backend application process
+	app := newBackend(cfg, store, backends.primary())
 
-	// Create health monitor
-	monitor := health.NewMonitor(cfg)
+	// Paths godevwatch serves itself instead of proxying them
+	local := newLocalRoutes(cfg, store)
 
 	// Setup proxy HTTP handlers
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if monitor.GetStatus() == health.StatusUp {
+		// local_routes don't need the backend. godevwatch's own endpoints are registered
+		// separately, so they take precedence over a local route prefix.
+		if handler, ok := local.match(r.URL.Path); ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// Wake up an idle backend and hold the request until it is ready
+		if app.touch() {
+			hold.extend(cfg.HoldTimeout)
+		}
+
+		// Enforce max_request_body, rejecting declared sizes up front and cutting off the rest while streaming
+		if cfg.MaxRequestBody > 0 {
+			if r.ContentLength > cfg.MaxRequestBody {
+				http.Error(w, fmt.Sprintf("Request body larger than %d bytes", cfg.MaxRequestBody), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxRequestBody)
+		}
+
+		monitor := backends.match(r.URL.Path)
+		if monitor.GetStatus() == health.StatusUp || hold.waitForBackend(r, monitor) {
 			// Backend is up, proxy the request
 			monitor.GetProxy().ServeHTTP(w, r)
 		} else {
 			// Backend is down, show waiting page
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprint(w, serverDownPage)
+			name, _ := json.Marshal(monitor.GetBackend().Name)
+			page := strings.Replace(downPage, "{{GENERATION}}", strconv.FormatUint(monitor.GetGeneration(), 10), 1)
+			page = strings.Replace(page, "{{BACKEND}}", string(name), 1)
+			fmt.Fprint(w, page)
 		}
 	})
 
 	// Health check endpoint
-	http.HandleFunc("/__health", func(w http.ResponseWriter, r *http.Request) {
-		if monitor.GetStatus() == health.StatusUp {
+	handleInternal(http.DefaultServeMux, cfg, "health", func(w http.ResponseWriter, r *http.Request) {
+		if backends.allUp() {
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, "OK")
 		} else {
@@ -132,105 +185,261 @@ func Start(cfg *config.Config) error {
 		}
 	})
 
+	// Readiness endpoint: ready only when every backend is up, no build is running and the
+	// latest build of every rule succeeded
+	handleInternal(http.DefaultServeMux, cfg, "ready", func(w http.ResponseWriter, r *http.Request) {
+		readiness := struct {
+			Ready          bool       `json:"ready"`
+			BackendUp      bool       `json:"backend_up"`
+			Building       bool       `json:"building"`
+			FailedRules    []string   `json:"failed_rules"`
+			LastTransition *time.Time `json:"last_transition,omitempty"`
+		}{
+			BackendUp:      backends.allUp(),
+			Building:       store.CurrentStatus().Building,
+			FailedRules:    store.FailedRules(),
+			LastTransition: backends.lastTransition.Load(),
+		}
+		readiness.Ready = readiness.BackendUp && !readiness.Building && len(readiness.FailedRules) == 0
+
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(readiness)
+	})
+
 	// Build status endpoint
-	http.HandleFunc("/__build-status", func(w http.ResponseWriter, r *http.Request) {
+	handleInternal(http.DefaultServeMux, cfg, "build-status", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		// Get current build status from the build status directory
-		buildStatus := getCurrentBuildStatus(cfg)
-		fmt.Fprint(w, buildStatus)
+		status := struct {
+			build.BuildStatus
+			LastTransition *time.Time `json:"last_transition,omitempty"`
+		}{store.CurrentStatus(), backends.lastTransition.Load()}
+		json.NewEncoder(w).Encode(status)
 	})
 
 	// Server-Sent Events endpoint for auto-reload
-	http.HandleFunc("/__reload", func(w http.ResponseWriter, r *http.Request) {
-		// Set SSE headers
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		// Get reload client channel
-		clientChan := monitor.AddReloadClient()
-		defer func() {
-			// Close cleanup is handled by the monitor when connection ends
-		}()
+	if cfg.ReloadEnabled() {
+		handleInternal(http.DefaultServeMux, cfg, "reload", func(w http.ResponseWriter, r *http.Request) {
+			// Reload events come from the backend the page belongs to
+			monitor := backends.byName(r.URL.Query().Get("backend"))
+
+			// Get reload client channel and build events, refusing clients beyond max_reload_clients
+			clientChan, ok := monitor.AddReloadClient(cfg.ReloadBufferSize, health.ParseDropPolicy(cfg.ReloadDropPolicy))
+			if !ok {
+				http.Error(w, "Too many reload clients", http.StatusServiceUnavailable)
+				return
+			}
+			defer monitor.RemoveReloadClient(clientChan)
+			buildEvents := store.Subscribe()
+			defer store.Unsubscribe(buildEvents)
+
+			// Set SSE headers
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+
+			// Tell the browser how quickly to reconnect if the connection drops
+			fmt.Fprintf(w, "retry: %d\n\n", cfg.ReloadRetry.Milliseconds())
+
+			// Send the current state straight away so the page doesn't wait for the next change
+			buildStatus := store.CurrentStatus()
+			snapshot, _ := json.Marshal(statusSnapshot{
+				Backend:      strings.ToLower(monitor.GetStatus().String()),
+				Building:     buildStatus.Building,
+				CurrentBuild: buildStatus.CurrentBuild,
+			})
+			writeEvent(w, "status", string(snapshot))
+
+			// Reload straight away if the backend came up since the client last saw it
+			if lastSeen := r.URL.Query().Get("generation"); lastSeen != "" {
+				if generation, err := strconv.ParseUint(lastSeen, 10, 64); err == nil && generation < monitor.GetGeneration() {
+					writeEvent(w, "", "reload")
+				}
+			}
 
-		// Keep connection alive and wait for reload signal
-		for {
-			select {
-			case msg := <-clientChan:
-				fmt.Fprintf(w, "data: %s\n\n", msg)
-				if flusher, ok := w.(http.Flusher); ok {
-					flusher.Flush()
+			// Keep connection alive and wait for reload signal
+			for {
+				select {
+				case msg := <-clientChan:
+					writeEvent(w, "", msg)
+				case event := <-buildEvents:
+					data, _ := json.Marshal(event.Record)
+					writeEvent(w, "build", string(data))
+				case <-r.Context().Done():
+					return
 				}
-			case <-r.Context().Done():
-				return
 			}
-		}
-	})
+		})
+	}
 
 	// Start proxy server in background
-	addr := fmt.Sprintf(":%d", cfg.ProxyPort)
-	server := &http.Server{Addr: addr}
+	server := &http.Server{Addr: cfg.ProxyAddr()}
 
 	go func() {
-		logger.Printf("[proxy] \033[32mStarted proxy server on http://localhost%s\033[0m\n", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Printf("[proxy] Server error: %v\n", err)
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			logger.Errorf("[proxy] Server error: %v\n", err)
+			return
+		}
+		logger.Printf("[proxy] \033[32mStarted proxy server on %s\033[0m\n", cfg.ProxyURL())
+
+		// The proxy is listening, so the page can load (or wait on the down page) right away
+		if cfg.OpenBrowser {
+			openBrowser(cfg.ProxyURL())
+		}
+
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("[proxy] Server error: %v\n", err)
 		}
 	}()
 
-	// Start health monitor
+	// Record backend transitions for the status API, then run the hooks that react to them
+	backends.trackTransitions()
+
+	// Run on_first_ready once, the first time every backend is up
+	if cfg.OnFirstReady != "" {
+		var firstReady sync.Once
+		for _, monitor := range backends.monitors {
+			monitor.AddStatusChangeCallback(func(oldStatus, newStatus health.Status) {
+				if newStatus == health.StatusUp && backends.allUp() {
+					firstReady.Do(func() { process.RunHook("on_first_ready", cfg.OnFirstReady) })
+				}
+			})
+		}
+	}
+
+	// Run on_backend_up / on_backend_down on every transition
+	if cfg.OnBackendUp != "" || cfg.OnBackendDown != "" {
+		for _, monitor := range backends.monitors {
+			name := monitor.GetBackend().Name
+			monitor.AddStatusChangeCallback(func(oldStatus, newStatus health.Status) {
+				hook, command := "on_backend_down", cfg.OnBackendDown
+				if newStatus == health.StatusUp {
+					hook, command = "on_backend_up", cfg.OnBackendUp
+				}
+				if command != "" {
+					process.RunHook(hook, command,
+						"GODEVWATCH_BACKEND_STATUS="+strings.ToLower(newStatus.String()),
+						"GODEVWATCH_BACKEND="+name)
+				}
+			})
+		}
+	}
+
+	// Start health monitors
 	monitorCtx, monitorCancel := context.WithCancel(context.Background())
 	defer monitorCancel()
-	monitor.Start(monitorCtx)
+	for _, monitor := range backends.monitors {
+		monitor.Start(monitorCtx)
+	}
 
 	// Run initial build for all rules (don't crash on failure)
-	fmt.Println()
-	var appCmd *exec.Cmd
-	if err := build.RunAll(cfg); err != nil {
-		logger.Printf("[proxy] \033[31mInitial build failed: %v\033[0m\n", err)
-		logger.Printf("[proxy] \033[33mProxy will continue running. Fix the build errors and file watcher will rebuild automatically.\033[0m\n")
+	logger.Infof("\n")
+	initialBuildOK := true
+	if cfg.SkipInitialBuild {
+		logger.Printf("[proxy] Skipping initial build\n")
+	} else if err := build.RunAll(cfg, store); err != nil {
+		initialBuildOK = false
+		logger.Errorf("[proxy] \033[31mInitial build failed: %v\033[0m\n", err)
+		logger.Warnf("[proxy] \033[33mProxy will continue running. Fix the build errors and file watcher will rebuild automatically.\033[0m\n")
 	} else {
 		logger.Printf("[proxy] \033[32mInitial build completed successfully\033[0m\n")
+	}
 
-		// Only try to start the application if build succeeded
-		var err error
-		appCmd, err = process.Start(cfg)
-		if err != nil {
-			logger.Printf("[proxy] \033[31mFailed to start backend: %v\033[0m\n", err)
-			logger.Printf("[proxy] \033[33mProxy will continue running. Backend will start after successful build.\033[0m\n")
+	// Only try to start the application if build succeeded
+	if cfg.ExternalBackend() {
+		logger.Printf("[proxy] Backend is managed externally, waiting for it on port %d\n", cfg.BackendPort)
+	} else if initialBuildOK {
+		if err := app.start(); err != nil {
+			logger.Errorf("[proxy] \033[31mFailed to start backend: %v\033[0m\n", err)
+			logger.Warnf("[proxy] \033[33mProxy will continue running. Backend will start after successful build.\033[0m\n")
 		}
 	}
-	fmt.Println()
+	logger.Infof("\n")
+
+	// Stop the backend when no requests arrive for a while
+	idleDone := make(chan struct{})
+	defer close(idleDone)
+	if cfg.IdleTimeout > 0 && !cfg.ExternalBackend() {
+		go app.watchIdle(idleDone)
+	}
 
 	// Create and start file watcher with backend restart capability
-	w, err := watcher.NewWatcher(cfg)
+	w, err := watcher.NewWatcher(cfg, store)
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
+	app.setRebuild(w.RebuildAll)
 
 	// Set up watcher to restart backend and trigger reload on successful builds
-	w.SetBuildSuccessCallback(func() {
+	w.SetBuildSuccessCallback(func(rule string) {
+		runBuildHook(cfg, rule, nil)
+		if cfg.ExternalBackend() {
+			logger.Printf("[proxy] Build succeeded, waiting for the external backend to restart\n")
+			return
+		}
 		logger.Printf("[proxy] Build succeeded, starting/restarting backend...\n")
+		if cfg.HoldRequestsDuringRestart {
+			hold.extend(cfg.RestartDebounce + cfg.HoldTimeout)
+		}
+		app.scheduleRestart()
+	})
+	w.SetBuildFailureCallback(func(rule string, err error) {
+		logger.Errorf("[proxy] \033[31mBuild failed: %s - %v\033[0m\n", rule, err)
+		runBuildHook(cfg, rule, err)
+	})
+
+	// In rerun mode the backend counts as building until it binds its port again
+	var rerunMu sync.Mutex
+	var rerunTracker *build.Tracker
+	w.SetRerunCallback(func() {
+		rerunMu.Lock()
+		defer rerunMu.Unlock()
 
-		// Kill existing backend if running
-		if appCmd != nil && appCmd.Process != nil {
-			logger.Printf("[proxy] Stopping existing backend...\n")
-			appCmd.Process.Kill()
-			appCmd.Wait() // Wait for process to exit
+		logger.Printf("[proxy] Change detected, rerunning backend...\n")
+		if cfg.HoldRequestsDuringRestart {
+			hold.extend(cfg.HoldTimeout)
 		}
 
-		// Start new backend
-		newCmd, err := process.Start(cfg)
-		if err != nil {
-			logger.Printf("[proxy] \033[31mFailed to start backend: %v\033[0m\n", err)
-		} else {
-			appCmd = newCmd
-			logger.Printf("[proxy] \033[32mBackend started successfully\033[0m\n")
-			// Monitor will detect the new backend and trigger reload automatically
+		if rerunTracker != nil {
+			rerunTracker.Abort()
+			rerunTracker = nil
+		}
+
+		// Nothing to wait for if the backend is idle or failed to start
+		if !app.restart() {
+			return
 		}
+		tracker := build.NewTracker(store, cfg.BuildStatusDir, "rerun", cfg.KeepStatus)
+		if err := tracker.Start(); err != nil {
+			logger.Warnf("[proxy] Warning: failed to start build tracking: %v\n", err)
+		}
+		rerunTracker = tracker
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), rerunReadyTimeout)
+			defer cancel()
+			up := app.monitor.WaitUntilUp(ctx)
+
+			rerunMu.Lock()
+			defer rerunMu.Unlock()
+			if rerunTracker != tracker {
+				return // Superseded by a newer rerun
+			}
+			rerunTracker = nil
+
+			if !up {
+				logger.Errorf("[proxy] \033[31mBackend did not come up within %s after rerun\033[0m\n", rerunReadyTimeout)
+				tracker.Fail()
+				return
+			}
+			tracker.Complete()
+		}()
 	})
 
 	// Start watcher in background
@@ -242,17 +451,35 @@ func Start(cfg *config.Config) error {
 
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	notifyDebugToggle(sigChan)
 
 	logger.Println("[proxy] Press Ctrl+C to stop")
 
-	// Wait for termination signal or watcher error
-	select {
-	case <-sigChan:
-		// User requested shutdown
-	case err := <-watcherDone:
-		if err != nil {
-			logger.Printf("[proxy] Watcher error: %v\n", err)
+	// Wait for termination signal or watcher error, reloading the rules and rebuilding on SIGHUP
+	// and toggling debug logging on SIGUSR1
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				logger.Printf("[proxy] Received SIGHUP, reloading build rules and rebuilding...\n")
+				reloadRules(cfg, w)
+				w.RebuildAll()
+				continue
+			}
+			if isDebugToggle(sig) {
+				logger.SetDebugMode(!logger.DebugMode())
+				logger.Warnf("[proxy] Debug logging %s\n", onOff(logger.DebugMode()))
+				continue
+			}
+			// User requested shutdown
+			break wait
+		case err := <-watcherDone:
+			if err != nil {
+				logger.Errorf("[proxy] Watcher error: %v\n", err)
+			}
+			break wait
 		}
 	}
 
@@ -263,15 +490,21 @@ func Start(cfg *config.Config) error {
 	logger.Println("\n[proxy] Shutting down...")
 
 	// Kill application process
-	if appCmd != nil && appCmd.Process != nil {
-		logger.Println("[proxy] Stopping backend application...")
-		appCmd.Process.Kill()
+	app.stop()
+
+	// Tear down what setup_cmds started, even if the backend never came up
+	if cfg.OnShutdown != "" {
+		process.RunHookWait("on_shutdown", cfg.OnShutdown, cfg.OnShutdownTimeout)
 	}
 
-	// Remove build status directory
-	logger.Printf("[proxy] Removing build status directory: %s\n", cfg.BuildStatusDir)
-	if err := os.RemoveAll(cfg.BuildStatusDir); err != nil {
-		logger.Printf("[proxy] Warning: failed to remove build status directory: %v\n", err)
+	// Remove the build status files we created, unless they're kept for inspection
+	if cfg.KeepStatus {
+		logger.Printf("[proxy] Keeping build status files in: %s\n", cfg.BuildStatusDir)
+	} else {
+		logger.Printf("[proxy] Removing build status files from: %s\n", cfg.BuildStatusDir)
+		if err := build.RemoveStatusFiles(); err != nil {
+			logger.Warnf("[proxy] Warning: failed to remove build status files: %v\n", err)
+		}
 	}
 
 	logger.Println("[proxy] Shutdown complete")
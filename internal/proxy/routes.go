@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/health"
+)
+
+// routes maps request paths to backend monitors by longest path prefix
+type routes struct {
+	monitors []*health.Monitor // In config order, the first one is the primary backend
+	byPrefix []*health.Monitor // Longest prefix first
+
+	// lastTransition is when a backend last came up or went down (nil before the first time)
+	lastTransition atomic.Pointer[time.Time]
+}
+
+// newRoutes creates a health monitor for every configured backend
+func newRoutes(cfg *config.Config) *routes {
+	r := &routes{}
+	for _, backend := range cfg.Backends {
+		r.monitors = append(r.monitors, health.NewMonitor(cfg, backend))
+	}
+
+	r.byPrefix = append([]*health.Monitor(nil), r.monitors...)
+	sort.SliceStable(r.byPrefix, func(i, j int) bool {
+		return len(r.byPrefix[i].GetBackend().PathPrefix) > len(r.byPrefix[j].GetBackend().PathPrefix)
+	})
+
+	return r
+}
+
+// match returns the monitor of the backend serving path, falling back to the primary backend
+func (r *routes) match(path string) *health.Monitor {
+	for _, monitor := range r.byPrefix {
+		if strings.HasPrefix(path, monitor.GetBackend().PathPrefix) {
+			return monitor
+		}
+	}
+	return r.primary()
+}
+
+// byName returns the monitor of the named backend, falling back to the primary backend
+func (r *routes) byName(name string) *health.Monitor {
+	for _, monitor := range r.monitors {
+		if monitor.GetBackend().Name == name {
+			return monitor
+		}
+	}
+	return r.primary()
+}
+
+// primary returns the monitor of the first configured backend
+func (r *routes) primary() *health.Monitor {
+	return r.monitors[0]
+}
+
+// allUp reports whether every backend is up
+func (r *routes) allUp() bool {
+	for _, monitor := range r.monitors {
+		if monitor.GetStatus() != health.StatusUp {
+			return false
+		}
+	}
+	return true
+}
+
+// trackTransitions records when a backend last came up or went down for the status API
+func (r *routes) trackTransitions() {
+	for _, monitor := range r.monitors {
+		monitor.AddStatusChangeCallback(func(oldStatus, newStatus health.Status) {
+			now := time.Now()
+			r.lastTransition.Store(&now)
+		})
+	}
+}
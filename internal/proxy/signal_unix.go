@@ -0,0 +1,19 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDebugToggle relays SIGUSR1, which toggles debug logging, to ch
+func notifyDebugToggle(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGUSR1)
+}
+
+// isDebugToggle reports whether sig toggles debug logging
+func isDebugToggle(sig os.Signal) bool {
+	return sig == syscall.SIGUSR1
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package proxy
+
+import "os"
+
+// notifyDebugToggle is a no-op on Windows, which has no SIGUSR1
+func notifyDebugToggle(ch chan<- os.Signal) {}
+
+// isDebugToggle always reports false on Windows
+func isDebugToggle(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+	"github.com/kyco/godevwatch/internal/process"
+	"github.com/kyco/godevwatch/internal/watcher"
+)
+
+// Watch runs only the file watcher and build rules: no proxy server, health monitor or backend
+func Watch(cfg *config.Config) error {
+	SetupLogging(cfg)
+	defer logger.CloseLogFiles()
+	logger.Infof("[watch] Using config %s\n", cfg.Path)
+
+	// Prepare the environment once before anything else
+	if err := process.Setup(cfg); err != nil {
+		return err
+	}
+
+	store := build.NewStore()
+	if err := build.PersistHistory(cfg, store); err != nil {
+		logger.Warnf("[watch] Warning: failed to open build history: %v\n", err)
+	}
+
+	// Run initial build for all rules (don't crash on failure)
+	if !cfg.SkipInitialBuild {
+		if err := build.RunAll(cfg, store); err != nil {
+			logger.Errorf("[watch] \033[31mInitial build failed: %v\033[0m\n", err)
+		} else {
+			logger.Infof("[watch] \033[32mInitial build completed successfully\033[0m\n")
+		}
+	}
+
+	w, err := watcher.NewWatcher(cfg, store)
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// Build results are the only output that matters in this mode, so always show them
+	w.SetBuildSuccessCallback(func(rule string) {
+		logger.Infof("[watch] \033[32m✓ Build succeeded: %s\033[0m\n", rule)
+		runBuildHook(cfg, rule, nil)
+	})
+	w.SetBuildFailureCallback(func(rule string, err error) {
+		logger.Errorf("[watch] \033[31mBuild failed: %s - %v\033[0m\n", rule, err)
+		runBuildHook(cfg, rule, err)
+	})
+
+	// In rerun mode there is neither a build nor a backend to restart, so a change only
+	// runs on_success
+	w.SetRerunCallback(func() {
+		logger.Infof("[watch] Change detected\n")
+		if cfg.OnSuccess != "" {
+			process.RunHook("on_success", cfg.OnSuccess)
+		}
+	})
+
+	// Start watcher in background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcherDone := make(chan error, 1)
+	go func() {
+		watcherDone <- w.Start(ctx)
+	}()
+
+	// Setup signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	notifyDebugToggle(sigChan)
+
+	logger.Infof("[watch] Watching for changes. Press Ctrl+C to stop\n")
+
+	// Wait for termination signal or watcher error, reloading the rules and rebuilding on SIGHUP
+	// and toggling debug logging on SIGUSR1
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				logger.Infof("[watch] Received SIGHUP, reloading build rules and rebuilding...\n")
+				reloadRules(cfg, w)
+				w.RebuildAll()
+				continue
+			}
+			if isDebugToggle(sig) {
+				logger.SetDebugMode(!logger.DebugMode())
+				logger.Infof("[watch] Debug logging %s\n", onOff(logger.DebugMode()))
+				continue
+			}
+			// User requested shutdown, stop the watcher and wait for it to abort running builds
+			cancel()
+			<-watcherDone
+			break wait
+		case err := <-watcherDone:
+			if err != nil {
+				logger.Errorf("[watch] Watcher error: %v\n", err)
+			}
+			break wait
+		}
+	}
+
+	// Remove the build status files we created, unless they're kept for inspection
+	if !cfg.KeepStatus {
+		if err := build.RemoveStatusFiles(); err != nil {
+			logger.Warnf("[watch] Warning: failed to remove build status files: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// reloadRules re-reads the config file and switches the watcher to its build rules. If the
+// file no longer loads, the current rules are kept.
+func reloadRules(cfg *config.Config, w *watcher.Watcher) {
+	next, err := config.Load(cfg.Path)
+	if err == nil {
+		err = w.UpdateConfig(next)
+	}
+	if err != nil {
+		logger.Warnf("[watcher] \033[33mKeeping the current build rules: %v\033[0m\n", err)
+	}
+}
+
+// runBuildHook runs on_success, or on_failure if err is set, after a build of rule
+func runBuildHook(cfg *config.Config, rule string, err error) {
+	if err != nil {
+		if cfg.OnFailure != "" {
+			process.RunHook("on_failure", cfg.OnFailure, "GODEVWATCH_RULE="+rule, "GODEVWATCH_ERROR="+err.Error())
+		}
+		return
+	}
+	if cfg.OnSuccess != "" {
+		process.RunHook("on_success", cfg.OnSuccess, "GODEVWATCH_RULE="+rule)
+	}
+}
@@ -0,0 +1,425 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+const (
+	// workspaceStopTimeout is how long a workspace may take to shut down before it is killed
+	workspaceStopTimeout = 10 * time.Second
+	// workspaceBackoff is the delay before a crashed workspace is restarted, doubled for
+	// each crash in a row up to workspaceMaxBackoff
+	workspaceBackoff    = time.Second
+	workspaceMaxBackoff = 30 * time.Second
+	// workspaceStable is how long a workspace has to run for a crash to count as a new one
+	// rather than one more in a row
+	workspaceStable = time.Minute
+)
+
+// workspace is a service run by a godevwatch process of its own, in its directory and
+// with its config, whose proxy this one forwards to. Crashed processes are restarted.
+type workspace struct {
+	config.Workspace
+	config     *config.Config // The workspace's own config
+	configPath string         // Absolute path of the workspace's config
+	proxyURL   *url.URL
+	proxy      *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd // The running process, nil while waiting to restart
+	restarts int
+	lastExit string // Why the process last exited, if it crashed
+
+	started bool          // Set once start succeeded
+	stop    chan struct{} // Closed to shut the workspace down
+	done    chan struct{} // Closed once the workspace has shut down
+}
+
+// StartWorkspaces runs every workspace with a godevwatch process of its own and proxies to
+// them, by host or by path prefix, until interrupted
+func StartWorkspaces(cfg *config.Config) error {
+	SetupLogging(cfg)
+	defer logger.CloseLogFiles()
+
+	workspaces, err := loadWorkspaces(cfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("godevwatch (%d workspaces)\n", len(workspaces))
+	logger.Infof("  Config:   %s\n", cfg.Path)
+	logger.Infof("  Proxy:    %s\n", cfg.ProxyURL())
+	for _, ws := range workspaces {
+		route := ws.PathPrefix
+		if ws.Host != "" {
+			route = "host " + ws.Host
+		}
+		logger.Infof("  %-9s %s -> %s (%s)\n", ws.Name+":", route, ws.proxyURL, ws.Dir)
+	}
+	logger.Infof("\n")
+
+	for _, ws := range workspaces {
+		if err := ws.start(cfg); err != nil {
+			stopWorkspaces(workspaces)
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	handleInternal(mux, cfg, "workspaces", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(workspaceStatuses(workspaces))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		ws, prefix := matchWorkspace(workspaces, r)
+		if ws == nil {
+			http.Error(w, fmt.Sprintf("No workspace serves %s%s (see %s)", r.Host, r.URL.Path, cfg.InternalPath("workspaces")), http.StatusNotFound)
+			return
+		}
+		if prefix == "" {
+			ws.proxy.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == strings.TrimSuffix(prefix, "/") {
+			http.Redirect(w, r, prefix, http.StatusMovedPermanently)
+			return
+		}
+		// The workspace serves its path prefix from /, and learns it from X-Forwarded-Prefix
+		r.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(prefix, "/"))
+		http.StripPrefix(strings.TrimSuffix(prefix, "/"), ws.proxy).ServeHTTP(w, r)
+	})
+
+	server := &http.Server{Addr: cfg.ProxyAddr(), Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		logger.Printf("[proxy] \033[32mStarted proxy server on %s\033[0m\n", cfg.ProxyURL())
+		if cfg.OpenBrowser {
+			openBrowser(cfg.ProxyURL())
+		}
+		serverErr <- server.Serve(listener)
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+	case err = <-serverErr:
+		logger.Errorf("[proxy] \033[31mServer error: %v\033[0m\n", err)
+	}
+
+	logger.Println("\n[proxy] Shutting down workspaces...")
+	stopWorkspaces(workspaces)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+
+	logger.Println("[proxy] Shutdown complete")
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// loadWorkspaces loads every workspace's config and checks that the workspaces can be told
+// apart
+func loadWorkspaces(cfg *config.Config) ([]*workspace, error) {
+	var workspaces []*workspace
+	ports := map[int]string{cfg.ProxyPort: "this proxy"}
+	prefixes := make(map[string]string)
+
+	for _, ws := range cfg.Workspaces {
+		configPath, err := filepath.Abs(ws.Config)
+		if err != nil {
+			return nil, err
+		}
+		wsConfig, err := config.LoadWorkspace(ws)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %s: %w", ws.Name, err)
+		}
+
+		if other, taken := ports[wsConfig.ProxyPort]; taken {
+			return nil, fmt.Errorf("workspace %s uses proxy_port %d, like %s; give each workspace its own", ws.Name, wsConfig.ProxyPort, other)
+		}
+		ports[wsConfig.ProxyPort] = "workspace " + ws.Name
+
+		// Pages served below a path prefix reach their workspace's endpoints (/__reload etc.)
+		// through its internal_prefix, so that must be unique too
+		if ws.Host == "" {
+			if other, taken := prefixes[wsConfig.InternalPrefix]; taken {
+				return nil, fmt.Errorf("workspaces %s and %s both use internal_prefix %q; give each its own so their endpoints can be told apart", other, ws.Name, wsConfig.InternalPrefix)
+			}
+			prefixes[wsConfig.InternalPrefix] = ws.Name
+		}
+
+		proxyURL, err := url.Parse(wsConfig.ProxyURL())
+		if err != nil {
+			return nil, fmt.Errorf("workspace %s: %w", ws.Name, err)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(proxyURL)
+		proxy.FlushInterval = cfg.FlushInterval
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("Workspace %s is not reachable: %v", ws.Name, err), http.StatusBadGateway)
+		}
+
+		workspaces = append(workspaces, &workspace{
+			Workspace:  ws,
+			config:     wsConfig,
+			configPath: configPath,
+			proxyURL:   proxyURL,
+			proxy:      proxy,
+			stop:       make(chan struct{}),
+			done:       make(chan struct{}),
+		})
+	}
+
+	return workspaces, nil
+}
+
+// start runs godevwatch for the workspace in its directory, and keeps restarting it with a
+// backoff if it crashes until the workspace is stopped
+func (ws *workspace) start(cfg *config.Config) error {
+	exited, err := ws.run(cfg)
+	if err != nil {
+		return err
+	}
+	ws.started = true
+	go ws.supervise(cfg, exited)
+	return nil
+}
+
+// run starts the workspace's godevwatch, with its output prefixed by the workspace's name.
+// The returned channel receives its exit error.
+func (ws *workspace) run(cfg *config.Config) (<-chan error, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the godevwatch executable: %w", err)
+	}
+
+	// Only this proxy opens the browser; the log level carries over
+	args := []string{"--config", ws.configPath, "--no-open"}
+	switch {
+	case logger.DebugMode():
+		args = append(args, "--debug")
+	case cfg.LogLevel == config.LogLevelSilent:
+		args = append(args, "--silent")
+	case cfg.LogLevel == config.LogLevelError:
+		args = append(args, "--quiet")
+	}
+
+	prefix := "[" + ws.Name + "] "
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = ws.Dir
+	cmd.Env = append(os.Environ(), "GODEVWATCH_WORKSPACE="+ws.Name)
+	cmd.Stdout = logger.NewPrefixWriter(prefix, os.Stdout, logger.NoLogFile)
+	cmd.Stderr = logger.NewPrefixWriter(prefix, os.Stderr, logger.NoLogFile)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start workspace %s: %w", ws.Name, err)
+	}
+
+	ws.mu.Lock()
+	ws.cmd = cmd
+	ws.mu.Unlock()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	return exited, nil
+}
+
+// supervise restarts the workspace's godevwatch each time it exits, until the workspace is
+// stopped
+func (ws *workspace) supervise(cfg *config.Config, exited <-chan error) {
+	defer close(ws.done)
+
+	backoff := workspaceBackoff
+	started := time.Now()
+	for {
+		var err error
+		select {
+		case err = <-exited:
+		case <-ws.stop:
+			ws.shutdown(exited)
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited unexpectedly")
+		}
+		if time.Since(started) > workspaceStable {
+			backoff = workspaceBackoff
+		}
+		ws.mu.Lock()
+		ws.cmd = nil
+		ws.lastExit = err.Error()
+		ws.mu.Unlock()
+		logger.Errorf("[proxy] \033[31mWorkspace %s exited: %v (restarting in %s)\033[0m\n", ws.Name, err, backoff)
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-ws.stop:
+				return
+			}
+			backoff = min(backoff*2, workspaceMaxBackoff)
+
+			started = time.Now()
+			if exited, err = ws.run(cfg); err == nil {
+				break
+			}
+			logger.Errorf("[proxy] \033[31m%v (retrying in %s)\033[0m\n", err, backoff)
+		}
+
+		ws.mu.Lock()
+		ws.restarts++
+		ws.mu.Unlock()
+		logger.Warnf("[proxy] \033[33mRestarted workspace %s\033[0m\n", ws.Name)
+	}
+}
+
+// shutdown interrupts the workspace's godevwatch so it shuts down its backend, and kills it
+// if it hasn't exited after workspaceStopTimeout
+func (ws *workspace) shutdown(exited <-chan error) {
+	ws.mu.Lock()
+	cmd := ws.cmd
+	ws.mu.Unlock()
+
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(workspaceStopTimeout):
+		logger.Warnf("[proxy] \033[33mWorkspace %s didn't stop within %s, killing it\033[0m\n", ws.Name, workspaceStopTimeout)
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	ws.mu.Lock()
+	ws.cmd = nil
+	ws.mu.Unlock()
+}
+
+// stopWorkspaces shuts down every started workspace and waits for them
+func stopWorkspaces(workspaces []*workspace) {
+	for _, ws := range workspaces {
+		if ws.started {
+			close(ws.stop)
+		}
+	}
+	for _, ws := range workspaces {
+		if ws.started {
+			<-ws.done
+		}
+	}
+}
+
+// matchWorkspace returns the workspace serving r: the one for its host, else the one with
+// the longest path prefix (or internal_prefix) the path starts with. prefix is the path
+// prefix to strip, if the request matched one.
+func matchWorkspace(workspaces []*workspace, r *http.Request) (ws *workspace, prefix string) {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, ws := range workspaces {
+		if ws.Host != "" && ws.Host == host {
+			return ws, ""
+		}
+	}
+
+	matched := 0
+	for _, candidate := range workspaces {
+		if candidate.Host != "" {
+			continue
+		}
+		// A bare /<name> redirects to the path prefix, so it matches too
+		if p := candidate.PathPrefix; len(p) > matched && (strings.HasPrefix(r.URL.Path, p) || r.URL.Path == strings.TrimSuffix(p, "/")) {
+			ws, prefix, matched = candidate, p, len(p)
+		}
+		// Its pages reach its internal endpoints through the internal prefix, which is not stripped
+		if p := candidate.config.InternalPath(""); len(p) > matched && strings.HasPrefix(r.URL.Path, p) {
+			ws, prefix, matched = candidate, "", len(p)
+		}
+	}
+	return ws, prefix
+}
+
+// workspaceStatus is a workspace's entry in the workspaces endpoint
+type workspaceStatus struct {
+	Name       string          `json:"name"`
+	Dir        string          `json:"dir"`
+	PathPrefix string          `json:"path_prefix,omitempty"`
+	Host       string          `json:"host,omitempty"`
+	ProxyURL   string          `json:"proxy_url"`
+	Running    bool            `json:"running"`
+	Restarts   int             `json:"restarts"`            // How often it was restarted after crashing
+	LastExit   string          `json:"last_exit,omitempty"` // Why it last crashed
+	Ready      json.RawMessage `json:"ready,omitempty"`     // The workspace's own readiness report
+	Error      string          `json:"error,omitempty"`
+}
+
+// workspaceStatuses asks every workspace for its readiness, in parallel
+func workspaceStatuses(workspaces []*workspace) []workspaceStatus {
+	client := &http.Client{Timeout: time.Second}
+	statuses := make([]workspaceStatus, len(workspaces))
+
+	var wg sync.WaitGroup
+	for i, ws := range workspaces {
+		statuses[i] = workspaceStatus{
+			Name:       ws.Name,
+			Dir:        ws.Dir,
+			PathPrefix: ws.PathPrefix,
+			Host:       ws.Host,
+			ProxyURL:   ws.proxyURL.String(),
+		}
+		ws.mu.Lock()
+		statuses[i].Running = ws.cmd != nil
+		statuses[i].Restarts, statuses[i].LastExit = ws.restarts, ws.lastExit
+		ws.mu.Unlock()
+		if !statuses[i].Running {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(ws.proxyURL.JoinPath(ws.config.InternalPath("ready")).String())
+			if err != nil {
+				statuses[i].Error = err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			var ready json.RawMessage
+			if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+				statuses[i].Error = fmt.Sprintf("invalid readiness report: %v", err)
+				return
+			}
+			statuses[i].Ready = ready
+		}()
+	}
+	wg.Wait()
+
+	return statuses
+}
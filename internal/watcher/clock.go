@@ -0,0 +1,49 @@
+package watcher
+
+import "time"
+
+// Clock is the time source of the watcher's scheduling: debouncing, retry delays, rebuild
+// loop detection and polling for git operations. A fake clock lets that be driven without
+// sleeping.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has passed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a call scheduled with Clock.AfterFunc
+type Timer interface {
+	// Stop cancels the call and reports whether it was still pending
+	Stop() bool
+}
+
+// realClock is the Clock backed by the time package, which watchers use unless told otherwise
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// SetClock makes the watcher schedule by clock instead of the system time. Call it before
+// Start.
+func (w *Watcher) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// wait blocks until d has passed on the watcher's clock, or done is closed (a nil done
+// never is). It reports whether the full delay passed.
+func (w *Watcher) wait(d time.Duration, done <-chan struct{}) bool {
+	elapsed := make(chan struct{})
+	timer := w.clock.AfterFunc(d, func() { close(elapsed) })
+	select {
+	case <-elapsed:
+		return true
+	case <-done:
+		timer.Stop()
+		return false
+	}
+}
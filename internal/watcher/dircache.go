@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// dirCacheFile is the file in build_status_dir that caches the resolved watch directories
+const dirCacheFile = "watch-dirs.json"
+
+// dirCache is the directory list of a previous start. Key identifies the patterns it was
+// resolved from, and each directory's modification time shows whether entries were added to
+// or removed from it since.
+type dirCache struct {
+	Key   string            `json:"key"`
+	Dirs  []cachedDir       `json:"dirs"`
+	Links map[string]string `json:"links,omitempty"` // Symlink targets followed with follow_symlinks
+}
+
+type cachedDir struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"mod_time"` // Unix nanoseconds
+}
+
+// cachedWatchDirs returns the cached watch directories and symlink targets if they are still
+// valid, and otherwise resolves them by walking the tree and updates the cache
+func (w *Watcher) cachedWatchDirs() ([]string, map[string]string, error) {
+	rules, ignore := w.buildRules(), w.globalIgnores()
+	key := dirCacheKey(rules, ignore, w.config.FollowSymlinks)
+	path := filepath.Join(w.config.BuildStatusDir, dirCacheFile)
+
+	if dirs, links, ok := loadDirCache(path, key); ok {
+		logger.Printf("[watcher] Using cached directory list (%d directories)\n", len(dirs))
+		return dirs, links, nil
+	}
+
+	dirs, links, err := w.resolveWatchDirs(rules, ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveDirCache(path, key, dirs, links); err != nil {
+		logger.Warnf("[watcher] Warning: failed to cache directory list: %v\n", err)
+	}
+	return dirs, links, nil
+}
+
+// dirCacheKey fingerprints everything the directory list is resolved from
+func dirCacheKey(rules []config.BuildRule, ignore []string, followSymlinks bool) string {
+	type ruleKey struct {
+		Watch, Ignore, Files []string
+	}
+	keys := make([]ruleKey, 0, len(rules))
+	for _, rule := range rules {
+		keys = append(keys, ruleKey{rule.Watch, rule.Ignore, rule.Files})
+	}
+
+	data, _ := json.Marshal(struct {
+		Rules          []ruleKey
+		Ignore         []string
+		FollowSymlinks bool `json:",omitempty"`
+	}{keys, ignore, followSymlinks})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadDirCache returns the cached directories if the cache was written for key and no
+// directory changed since. Adding or removing a subdirectory changes its parent's
+// modification time, so a new directory below a watched one is always noticed.
+func loadDirCache(path, key string) ([]string, map[string]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	var cache dirCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Key != key {
+		return nil, nil, false
+	}
+
+	dirs := make([]string, 0, len(cache.Dirs))
+	for _, dir := range cache.Dirs {
+		info, err := os.Stat(dir.Path)
+		if err != nil || !info.IsDir() || info.ModTime().UnixNano() != dir.ModTime {
+			logger.Printf("[watcher] Directory list cache is stale (%s changed)\n", dir.Path)
+			return nil, nil, false
+		}
+		dirs = append(dirs, dir.Path)
+	}
+	return dirs, cache.Links, true
+}
+
+// saveDirCache writes the directory list with the current modification times
+func saveDirCache(path, key string, dirs []string, links map[string]string) error {
+	cache := dirCache{Key: key, Dirs: make([]cachedDir, 0, len(dirs)), Links: links}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		cache.Dirs = append(cache.Dirs, cachedDir{Path: dir, ModTime: info.ModTime().UnixNano()})
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	// The cache is kept across runs, so it isn't removed with the status files
+	return build.WritePersistentFile(path, data)
+}
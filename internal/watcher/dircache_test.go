@@ -0,0 +1,39 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDirCache(t *testing.T) {
+	root := t.TempDir()
+	dirs := []string{root, filepath.Join(root, "cmd")}
+	if err := os.Mkdir(dirs[1], 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "status", dirCacheFile)
+
+	if err := saveDirCache(path, "key", dirs, nil); err != nil {
+		t.Fatalf("saveDirCache: %v", err)
+	}
+	if cached, _, ok := loadDirCache(path, "key"); !ok || !slices.Equal(cached, dirs) {
+		t.Fatalf("loadDirCache = %v, %v, want %v", cached, ok, dirs)
+	}
+
+	// Different patterns resolve to different directories
+	if _, _, ok := loadDirCache(path, "other-key"); ok {
+		t.Error("cache used for a different key")
+	}
+
+	// Adding or removing an entry changes the directory's modification time
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(dirs[1], later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := loadDirCache(path, "key"); ok {
+		t.Error("cache used after a directory changed")
+	}
+}
@@ -0,0 +1,33 @@
+package watcher
+
+import (
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatcher reports changes to the files in the directories added to it
+type fileWatcher interface {
+	Add(dir string) error
+	Remove(dir string) error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// dirWatcher watches each directory individually through fsnotify
+type dirWatcher struct {
+	watcher *fsnotify.Watcher
+}
+
+func newDirWatcher() (*dirWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &dirWatcher{watcher: watcher}, nil
+}
+
+func (d *dirWatcher) Add(dir string) error          { return d.watcher.Add(dir) }
+func (d *dirWatcher) Remove(dir string) error       { return d.watcher.Remove(dir) }
+func (d *dirWatcher) Events() <-chan fsnotify.Event { return d.watcher.Events }
+func (d *dirWatcher) Errors() <-chan error          { return d.watcher.Errors }
+func (d *dirWatcher) Close() error                  { return d.watcher.Close() }
@@ -0,0 +1,162 @@
+//go:build darwin && cgo
+
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsevents"
+	"github.com/fsnotify/fsnotify"
+)
+
+// fseventsLatency is how long FSEvents collects changes before delivering them
+const fseventsLatency = 50 * time.Millisecond
+
+// recursiveWatcher watches the whole project with a single FSEvents stream instead of one
+// watch per directory. Events are only reported for the added directories, so ignored
+// directories stay ignored just like with per-directory watches.
+type recursiveWatcher struct {
+	stream *fsevents.EventStream
+	root   string // Absolute project directory, with symlinks resolved like FSEvents reports it
+	events chan fsnotify.Event
+	errors chan error
+	done   chan struct{}
+
+	mu   sync.RWMutex
+	dirs map[string]bool // Watched directories, relative to root
+}
+
+// newRecursiveWatcher starts an FSEvents stream for the current directory
+func newRecursiveWatcher() (fileWatcher, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recursiveWatcher{
+		stream: &fsevents.EventStream{
+			Paths:   []string{root},
+			Latency: fseventsLatency,
+			Flags:   fsevents.FileEvents | fsevents.NoDefer,
+		},
+		root:   root,
+		events: make(chan fsnotify.Event, 100),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		dirs:   make(map[string]bool),
+	}
+	if err := r.stream.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start FSEvents stream: %w", err)
+	}
+	go r.forward()
+	return r, nil
+}
+
+func (r *recursiveWatcher) Add(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dirs[filepath.Clean(dir)] = true
+	return nil
+}
+
+func (r *recursiveWatcher) Remove(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.dirs, filepath.Clean(dir))
+	return nil
+}
+
+func (r *recursiveWatcher) Events() <-chan fsnotify.Event { return r.events }
+func (r *recursiveWatcher) Errors() <-chan error          { return r.errors }
+
+func (r *recursiveWatcher) Close() error {
+	close(r.done)
+
+	// Keep draining the stream so a callback delivering events can't block Stop
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-r.stream.Events:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	r.stream.Stop()
+	close(stopped)
+	return nil
+}
+
+// forward translates FSEvents into fsnotify events for the watched directories
+func (r *recursiveWatcher) forward() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case batch := <-r.stream.Events:
+			for _, event := range batch {
+				name, ok := r.relative(event.Path)
+				if !ok {
+					continue
+				}
+				op := translateFlags(event.Flags, name)
+				if op == 0 {
+					continue
+				}
+				select {
+				case r.events <- fsnotify.Event{Name: name, Op: op}:
+				case <-r.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// relative returns the event path relative to the project, if its directory is watched
+func (r *recursiveWatcher) relative(path string) (string, bool) {
+	rel, err := filepath.Rel(r.root, "/"+strings.TrimPrefix(path, "/"))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rel, r.dirs[filepath.Dir(rel)]
+}
+
+// translateFlags maps FSEvents flags to fsnotify operations. FSEvents reports both names of
+// a rename as renamed, so the new name, which exists, is reported as created like fsnotify does.
+func translateFlags(flags fsevents.EventFlags, name string) fsnotify.Op {
+	var op fsnotify.Op
+	if flags&fsevents.ItemCreated != 0 {
+		op |= fsnotify.Create
+	}
+	if flags&fsevents.ItemRemoved != 0 {
+		op |= fsnotify.Remove
+	}
+	if flags&fsevents.ItemRenamed != 0 {
+		if _, err := os.Lstat(name); err == nil {
+			op |= fsnotify.Create
+		} else {
+			op |= fsnotify.Rename
+		}
+	}
+	if flags&fsevents.ItemModified != 0 {
+		op |= fsnotify.Write
+	}
+	if flags&(fsevents.ItemInodeMetaMod|fsevents.ItemChangeOwner|fsevents.ItemXattrMod) != 0 {
+		op |= fsnotify.Chmod
+	}
+	return op
+}
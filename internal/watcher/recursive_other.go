@@ -0,0 +1,10 @@
+//go:build !darwin || !cgo
+
+package watcher
+
+import "errors"
+
+// newRecursiveWatcher is only available on macOS, where FSEvents watches a whole tree at once
+func newRecursiveWatcher() (fileWatcher, error) {
+	return nil, errors.New("recursive_watch needs macOS and a build with cgo enabled")
+}
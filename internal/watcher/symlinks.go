@@ -0,0 +1,108 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kyco/godevwatch/internal/logger"
+)
+
+// symlinkResolver follows symlinked directories for follow_symlinks. Their targets are
+// watched by their real paths, and links maps those back to the symlinks in the project.
+type symlinkResolver struct {
+	root    string            // Real path of the project
+	links   map[string]string // Real path of a followed target -> symlink path in the project
+	visited map[string]bool   // Real directories already walked, which breaks symlink cycles
+}
+
+// newSymlinkResolver creates a resolver for the project in the working directory that records
+// the targets it follows in links
+func newSymlinkResolver(links map[string]string) (*symlinkResolver, error) {
+	root, err := filepath.EvalSymlinks(".")
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &symlinkResolver{
+		root:    root,
+		links:   links,
+		visited: make(map[string]bool),
+	}, nil
+}
+
+// follow returns the real directories below the target of link, a symlink in the project,
+// without descending into directories that match an ignore pattern (by their path below
+// link). Links that are dangling, don't point at a directory, point into the project or
+// were followed already are skipped.
+func (s *symlinkResolver) follow(w *Watcher, link string, ignore []string) []string {
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil
+	}
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		return nil
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return nil
+	}
+	if target == s.root || strings.HasPrefix(target, s.root+string(filepath.Separator)) {
+		return nil
+	}
+	if s.visited[target] {
+		logger.Printf("[watcher] Not following %s again (-> %s)\n", link, target)
+		return nil
+	}
+
+	logger.Printf("[watcher] Following symlink %s -> %s\n", link, target)
+	s.links[target] = link
+
+	var dirs []string
+	filepath.WalkDir(target, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(target, path)
+		if err != nil {
+			return nil
+		}
+		logical := filepath.Join(link, rel)
+
+		if d.Type()&os.ModeSymlink != 0 {
+			dirs = append(dirs, s.follow(w, logical, ignore)...)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if s.visited[path] || w.matchesDirectory(logical, ignore) || d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		s.visited[path] = true
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs
+}
+
+// logicalPath maps a path below a followed symlink target back to the path below the
+// symlink, so rules match it like any file in the project
+func logicalPath(name string, links map[string]string) string {
+	if len(links) == 0 || !filepath.IsAbs(name) {
+		return name
+	}
+
+	best := ""
+	for target := range links {
+		if (name == target || strings.HasPrefix(name, target+string(filepath.Separator))) && len(target) > len(best) {
+			best = target
+		}
+	}
+	if best == "" {
+		return name
+	}
+	return filepath.Join(links[best], strings.TrimPrefix(name, best))
+}
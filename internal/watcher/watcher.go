@@ -3,64 +3,160 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/kyco/godevwatch/internal/build"
 	"github.com/kyco/godevwatch/internal/config"
 	"github.com/kyco/godevwatch/internal/logger"
+	"github.com/kyco/godevwatch/internal/pattern"
 )
 
 // Watcher manages file watching and build execution
 type Watcher struct {
-	config       *config.Config
-	fsWatcher    *fsnotify.Watcher
-	buildTracker *build.Tracker
+	config      *config.Config // Settings from startup; never changed, reloads only replace the fields below
+	configMu    sync.RWMutex   // Guards rules, tempFilePatterns, ignore, watchedDirs and links
+	rules       []config.BuildRule
+	tempFiles   []string // temp_file_patterns
+	ignore      []string // Global ignore patterns, build outputs and the build status directory
+	fsWatcher   fileWatcher
+	watchedDirs map[string]bool   // Directories registered with fsWatcher
+	links       map[string]string // Followed symlink target -> symlink, with follow_symlinks
+	buildStore  *build.Store
+	clock       Clock
 
 	// Process management
 	mu            sync.RWMutex
 	runningBuilds map[string]*RunningBuild // rule name -> running build
+	failureStreak map[string]int           // rule name -> consecutive failures
+	blocked       map[string]*pendingBuild // rule name -> build waiting for its dependencies
+	serialized    map[string]*pendingBuild // rule name -> build waiting for a rule it is serialized with
+	guarding      map[string]bool          // rule name -> its when_cmd is running
+	recentBuilds  map[string][]time.Time   // rule name -> start times of self-triggered builds within the loop window
+	lastFinished  map[string]time.Time     // rule name -> when its latest build finished
+	looping       map[string]bool          // rule name -> paused as a rebuild loop
 
 	// Debouncing
-	debounceTimer map[string]*time.Timer // rule name -> timer
+	debounceTimer map[string]Timer    // rule name -> timer
+	debounceFiles map[string]*fileSet // rule name -> files changed since the last build
+	debounceSelf  map[string]bool     // rule name -> every change so far came during or just after its own build
 	debounceMu    sync.Mutex
 	debounceDelay time.Duration
+	adaptiveDelay map[string]time.Duration // rule name -> current delay with adaptive_debounce
+
+	// Builds held back while a git operation is in progress
+	gitPending map[string]*pendingBuild // rule name -> build
+	gitMu      sync.Mutex
+
+	// Change logging (rate limited so bulk changes don't flood the terminal)
+	changeLogMu         sync.Mutex
+	changeLogCount      int
+	changeLogSuppressed int
+	changeLogTimer      Timer
 
 	// Callbacks
-	buildSuccessCallback func()
+	buildSuccessCallback func(rule string)
+	buildFailureCallback func(rule string, err error)
+	rerunCallback        func()
 }
 
+const (
+	// changeLogWindow is the period over which file change log lines are rate limited
+	changeLogWindow = 500 * time.Millisecond
+	// changeLogLimit is the number of file changes logged individually per window
+	changeLogLimit = 10
+	// gitPollInterval is how often the git lock file is checked while builds are paused
+	gitPollInterval = 200 * time.Millisecond
+	// loopSettle is how long after a rule's build finishes changes still count as written by
+	// that build for loop detection
+	loopSettle = 250 * time.Millisecond
+)
+
 // RunningBuild tracks a currently executing build process
 type RunningBuild struct {
 	Rule    *config.BuildRule
 	Process *exec.Cmd
+	Output  *build.OutputBuffer
 	Tracker *build.Tracker
 	Cancel  context.CancelFunc
 	BuildID string
+
+	// Container is the name of the docker container the build runs in, if any
+	Container string
+
+	command config.Commands // Command steps of the build, run again by retries
+	ctx     context.Context // Canceled when the build is aborted
+}
+
+// pendingBuild is a build that has been triggered but not started yet. It names its rule,
+// which is looked up when the build starts, so a config reload in between takes effect.
+type pendingBuild struct {
+	name  string
+	files []string // Files whose changes triggered the build
+
+	// selfTriggered is set when every change arrived while the rule was building or just
+	// after, so the build may have triggered itself
+	selfTriggered bool
+
+	guarded bool // The rule's when_cmd has passed
 }
 
-// NewWatcher creates a new file watcher
-func NewWatcher(cfg *config.Config) (*Watcher, error) {
-	fsWatcher, err := fsnotify.NewWatcher()
+// NewWatcher creates a new file watcher that reports build status to store
+func NewWatcher(cfg *config.Config, store *build.Store) (*Watcher, error) {
+	fsWatcher, err := newFileWatcher(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fs watcher: %w", err)
 	}
 
+	store.SetRules(ruleNames(cfg.BuildRules))
 	return &Watcher{
 		config:        cfg,
+		rules:         cfg.BuildRules,
+		tempFiles:     cfg.TempFilePatterns,
+		ignore:        ignorePatterns(cfg),
 		fsWatcher:     fsWatcher,
+		watchedDirs:   make(map[string]bool),
+		buildStore:    store,
+		clock:         realClock{},
 		runningBuilds: make(map[string]*RunningBuild),
-		debounceTimer: make(map[string]*time.Timer),
+		failureStreak: make(map[string]int),
+		blocked:       make(map[string]*pendingBuild),
+		serialized:    make(map[string]*pendingBuild),
+		guarding:      make(map[string]bool),
+		recentBuilds:  make(map[string][]time.Time),
+		lastFinished:  make(map[string]time.Time),
+		looping:       make(map[string]bool),
+		debounceTimer: make(map[string]Timer),
+		debounceFiles: make(map[string]*fileSet),
+		debounceSelf:  make(map[string]bool),
+		adaptiveDelay: make(map[string]time.Duration),
+		gitPending:    make(map[string]*pendingBuild),
 		debounceDelay: 100 * time.Millisecond, // 100ms debounce
 	}, nil
 }
 
+// newFileWatcher creates the watcher that reports file changes: a single recursive watch
+// with recursive_watch on macOS, one watch per directory otherwise
+func newFileWatcher(cfg *config.Config) (fileWatcher, error) {
+	if cfg.RecursiveWatch && cfg.FollowSymlinks {
+		logger.Warnf("[watcher] \033[33mWarning: recursive_watch doesn't see symlink targets, watching each directory instead\033[0m\n")
+	} else if cfg.RecursiveWatch {
+		fsWatcher, err := newRecursiveWatcher()
+		if err == nil {
+			logger.Printf("[watcher] Watching the project recursively through FSEvents\n")
+			return fsWatcher, nil
+		}
+		logger.Warnf("[watcher] \033[33mWarning: %v, watching each directory instead\033[0m\n", err)
+	}
+	return newDirWatcher()
+}
+
 // Start begins watching files and handling changes
 func (w *Watcher) Start(ctx context.Context) error {
 	// Add all watch patterns to the file system watcher
@@ -68,6 +164,11 @@ func (w *Watcher) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to setup watchers: %w", err)
 	}
 
+	// Warn about patterns that don't match anything (likely a typo)
+	if !w.config.DisablePatternWarnings {
+		w.warnUnmatchedPatterns()
+	}
+
 	logger.Printf("[watcher] Started watching files\n")
 
 	// Main event loop
@@ -78,58 +179,324 @@ func (w *Watcher) Start(ctx context.Context) error {
 			w.stopAllBuilds()
 			return w.fsWatcher.Close()
 
-		case event, ok := <-w.fsWatcher.Events:
+		case event, ok := <-w.fsWatcher.Events():
 			if !ok {
 				return fmt.Errorf("watcher events channel closed")
 			}
 			w.handleFileEvent(event)
 
-		case err, ok := <-w.fsWatcher.Errors:
+		case err, ok := <-w.fsWatcher.Errors():
 			if !ok {
 				return fmt.Errorf("watcher errors channel closed")
 			}
-			logger.Printf("[watcher] Error: %v\n", err)
+			logger.Errorf("[watcher] Error: %v\n", err)
 		}
 	}
 }
 
 // setupWatchers adds all directories that need to be watched
 func (w *Watcher) setupWatchers() error {
-	watchedDirs := make(map[string]bool)
+	var dirs []string
+	var links map[string]string
+	var err error
+	if w.config.CacheWatchDirs {
+		dirs, links, err = w.cachedWatchDirs()
+	} else {
+		dirs, links, err = w.resolveWatchDirs(w.buildRules(), w.globalIgnores())
+	}
+	if err != nil {
+		return err
+	}
+
+	w.configMu.Lock()
+	w.links = links
+	w.configMu.Unlock()
+
+	for _, dir := range dirs {
+		if err := w.fsWatcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch directory %s: %w", dir, err)
+		}
+		w.watchedDirs[dir] = true
+		logger.Printf("[watcher] Watching directory: %s\n", dir)
+	}
+
+	return nil
+}
 
-	for _, rule := range w.config.BuildRules {
+// resolveWatchDirs returns the directories the given rules need watched, in discovery order,
+// and the symlink targets followed with follow_symlinks. Directories matching a global ignore
+// pattern are never watched.
+func (w *Watcher) resolveWatchDirs(rules []config.BuildRule, ignore []string) ([]string, map[string]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	links := make(map[string]string)
+
+	for _, rule := range rules {
 		for _, pattern := range rule.Watch {
-			dirs, err := w.getDirectoriesToWatch(pattern)
+			dirs, err := w.getDirectoriesToWatch(pattern, ignore, links)
 			if err != nil {
-				return fmt.Errorf("failed to get directories for pattern %s: %w", pattern, err)
+				return nil, nil, fmt.Errorf("failed to get directories for pattern %s: %w", pattern, err)
 			}
 
 			for _, dir := range dirs {
 				// Skip directories that match ignore patterns
-				if w.shouldIgnoreDirectory(dir, &rule) {
+				if w.matchesDirectory(dir, ignore) || w.matchesDirectory(dir, rule.Ignore) {
 					continue
 				}
 
-				if !watchedDirs[dir] {
-					if err := w.fsWatcher.Add(dir); err != nil {
-						return fmt.Errorf("failed to watch directory %s: %w", dir, err)
-					}
-					watchedDirs[dir] = true
-					logger.Printf("[watcher] Watching directory: %s\n", dir)
+				if !seen[dir] {
+					seen[dir] = true
+					result = append(result, dir)
 				}
 			}
 		}
+
+		// Explicit files are watched through their containing directory
+		for _, file := range rule.Files {
+			dir := filepath.Dir(filepath.Clean(file))
+			if !seen[dir] {
+				seen[dir] = true
+				result = append(result, dir)
+			}
+		}
+	}
+
+	return result, links, nil
+}
+
+// UpdateConfig switches the watcher to the build rules, ignores and temp file patterns of a
+// newly loaded config; other settings only change on restart. Watches are added and removed
+// for directories that changed. Builds of removed rules are aborted and their pending builds
+// dropped, while running builds of the other rules finish under their old rule.
+func (w *Watcher) UpdateConfig(cfg *config.Config) error {
+	ignore := ignorePatterns(cfg)
+	dirs, links, err := w.resolveWatchDirs(cfg.BuildRules, ignore)
+	if err != nil {
+		return err
 	}
 
+	// The new rules get a fresh chance if a rebuild loop was fixed
+	w.Resume()
+
+	w.configMu.Lock()
+
+	// Add watches for new directories
+	wanted := make(map[string]bool)
+	for _, dir := range dirs {
+		wanted[dir] = true
+		if w.watchedDirs[dir] {
+			continue
+		}
+		if err := w.fsWatcher.Add(dir); err != nil {
+			w.configMu.Unlock()
+			return fmt.Errorf("failed to watch directory %s: %w", dir, err)
+		}
+		w.watchedDirs[dir] = true
+		logger.Printf("[watcher] Watching directory: %s\n", dir)
+	}
+
+	// Remove watches for directories no longer needed
+	for dir := range w.watchedDirs {
+		if wanted[dir] {
+			continue
+		}
+		if err := w.fsWatcher.Remove(dir); err != nil {
+			logger.Warnf("[watcher] Failed to stop watching directory %s: %v\n", dir, err)
+		}
+		delete(w.watchedDirs, dir)
+		logger.Printf("[watcher] Stopped watching directory: %s\n", dir)
+	}
+
+	// Swap in the new rules; the old slices stay intact for builds still using them
+	remaining := make(map[string]bool)
+	for _, rule := range cfg.BuildRules {
+		remaining[rule.Name] = true
+	}
+	var removed []string
+	for _, rule := range w.rules {
+		if !remaining[rule.Name] {
+			removed = append(removed, rule.Name)
+		}
+	}
+	w.rules = cfg.BuildRules
+	w.tempFiles = cfg.TempFilePatterns
+	w.ignore = ignore
+	w.links = links
+	w.configMu.Unlock()
+
+	for _, name := range removed {
+		logger.Printf("[watcher] Removed rule: %s\n", name)
+		w.removeRule(name)
+	}
+	w.buildStore.SetRules(ruleNames(cfg.BuildRules))
+	logger.Printf("[watcher] Updated build rules (%d rule(s))\n", len(cfg.BuildRules))
+
 	return nil
 }
 
-// getDirectoriesToWatch extracts directories from glob patterns
-func (w *Watcher) getDirectoriesToWatch(pattern string) ([]string, error) {
+// removeRule aborts the running build of a rule that was removed from the config, and drops
+// its pending builds and state
+func (w *Watcher) removeRule(name string) {
+	w.debounceMu.Lock()
+	if timer, pending := w.debounceTimer[name]; pending {
+		timer.Stop()
+	}
+	delete(w.debounceTimer, name)
+	delete(w.debounceFiles, name)
+	delete(w.debounceSelf, name)
+	delete(w.adaptiveDelay, name)
+	w.debounceMu.Unlock()
+
+	w.gitMu.Lock()
+	delete(w.gitPending, name)
+	w.gitMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if rb, running := w.runningBuilds[name]; running {
+		logger.Printf("[watcher] Aborting build of removed rule: %s\n", name)
+		w.abortBuild(rb)
+	}
+	delete(w.blocked, name)
+	delete(w.serialized, name)
+	delete(w.guarding, name)
+	delete(w.failureStreak, name)
+	delete(w.recentBuilds, name)
+	delete(w.lastFinished, name)
+	delete(w.looping, name)
+}
+
+// buildRules returns the current build rules
+func (w *Watcher) buildRules() []config.BuildRule {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.rules
+}
+
+// rule returns a copy of the current build rule with the given name, or nil if the rule
+// no longer exists. The copy stays the same while a build runs, even if the config is reloaded.
+func (w *Watcher) rule(name string) *config.BuildRule {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	for _, rule := range w.rules {
+		if rule.Name == name {
+			return &rule
+		}
+	}
+	return nil
+}
+
+// globalIgnores returns the ignore patterns that apply to every rule
+func (w *Watcher) globalIgnores() []string {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.ignore
+}
+
+// ignorePatterns returns the configured global ignores plus everything godevwatch and the
+// build rules write themselves, so that builds never trigger themselves
+func ignorePatterns(cfg *config.Config) []string {
+	patterns := append([]string(nil), cfg.Ignore...)
+	patterns = append(patterns, outputPattern(cfg.BuildStatusDir+"/"))
+	if cfg.LogDir != "" {
+		patterns = append(patterns, outputPattern(cfg.LogDir+"/"))
+	}
+
+	for i := range cfg.BuildRules {
+		for _, output := range cfg.BuildRules[i].OutputPaths() {
+			pattern := outputPattern(output)
+			logger.Printf("[watcher] Ignoring build output of %s: %s\n", cfg.BuildRules[i].Name, pattern)
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// outputPattern turns an output path into an ignore pattern, matching everything below it
+// for directories (paths ending in a slash)
+func outputPattern(path string) string {
+	isDir := strings.HasSuffix(path, "/")
+	if rel, err := filepath.Rel(".", path); err == nil {
+		path = rel
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if isDir {
+		return path + "/**"
+	}
+	return path
+}
+
+// warnUnmatchedPatterns logs a warning for every watch pattern that matches no existing file.
+// This is purely diagnostic: files created later will still trigger builds.
+func (w *Watcher) warnUnmatchedPatterns() {
+	matched := make(map[string]bool)
+	check := func(path string) {
+		for _, rule := range w.buildRules() {
+			for _, p := range rule.Watch {
+				if !matched[p] && pattern.Match(path, p) {
+					matched[p] = true
+				}
+			}
+		}
+	}
+
+	filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		check(path)
+		return nil
+	})
+
+	// Files below followed symlinks match by their path below the symlink
+	w.configMu.RLock()
+	links := w.links
+	w.configMu.RUnlock()
+	for target, link := range links {
+		filepath.WalkDir(target, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				check(logicalPath(path, map[string]string{target: link}))
+			}
+			return nil
+		})
+	}
+
+	for _, rule := range w.buildRules() {
+		for _, p := range rule.Watch {
+			if !matched[p] {
+				logger.Warnf("[watcher] \033[33mWarning: pattern %q in rule %s matches no files\033[0m\n", p, rule.Name)
+			}
+		}
+		for _, file := range rule.Files {
+			if _, err := os.Stat(file); err != nil {
+				logger.Warnf("[watcher] \033[33mWarning: file %q in rule %s does not exist\033[0m\n", file, rule.Name)
+			}
+		}
+	}
+}
+
+// getDirectoriesToWatch extracts directories from glob patterns, without descending into
+// directories that match an ignore pattern. With follow_symlinks, the real directories below
+// symlinked ones are included and the targets recorded in links.
+func (w *Watcher) getDirectoriesToWatch(pattern string, ignore []string, links map[string]string) ([]string, error) {
 	var dirs []string
 
 	// Handle recursive patterns like **/*.go
 	if strings.Contains(pattern, "**") {
+		var symlinks *symlinkResolver
+		if w.config.FollowSymlinks {
+			var err error
+			if symlinks, err = newSymlinkResolver(links); err != nil {
+				return nil, err
+			}
+		}
+
 		// Add current directory and walk subdirectories
 		dirs = append(dirs, ".")
 
@@ -137,6 +504,13 @@ func (w *Watcher) getDirectoriesToWatch(pattern string) ([]string, error) {
 			if err != nil {
 				return err
 			}
+			if symlinks != nil && d.Type()&os.ModeSymlink != 0 && !w.matchesDirectory(path, ignore) {
+				dirs = append(dirs, symlinks.follow(w, path, ignore)...)
+				return nil
+			}
+			if d.IsDir() && path != "." && w.matchesDirectory(path, ignore) {
+				return filepath.SkipDir
+			}
 			if d.IsDir() && !strings.HasPrefix(path, ".git") {
 				dirs = append(dirs, path)
 			}
@@ -160,10 +534,13 @@ func (w *Watcher) getDirectoriesToWatch(pattern string) ([]string, error) {
 
 // handleFileEvent processes file system events
 func (w *Watcher) handleFileEvent(event fsnotify.Event) {
-	// Skip temporary files and hidden files
-	if strings.HasPrefix(filepath.Base(event.Name), ".") ||
-		strings.HasSuffix(event.Name, "~") ||
-		strings.Contains(event.Name, ".tmp") {
+	// Changes below a followed symlink's target count as changes below the symlink
+	w.configMu.RLock()
+	event.Name = logicalPath(event.Name, w.links)
+	w.configMu.RUnlock()
+
+	// Skip editor temp files, unless a rule explicitly watches the file
+	if w.isTempFile(event.Name) && !w.explicitlyWatched(event.Name) {
 		return
 	}
 
@@ -172,147 +549,351 @@ func (w *Watcher) handleFileEvent(event fsnotify.Event) {
 		return
 	}
 
-	// Only handle write and create events
-	if event.Op&fsnotify.Write == 0 && event.Op&fsnotify.Create == 0 {
+	// Only handle the operations some rule listens for
+	rules := w.buildRules()
+	var ops fsnotify.Op
+	for i := range rules {
+		ops |= ruleEvents(&rules[i])
+	}
+	if event.Op&ops == 0 {
 		return
 	}
 
-	logger.Printf("[watcher] File changed: %s\n", event.Name)
+	w.logFileChange(event.Name)
 
 	// Check which build rules should be triggered
-	for i := range w.config.BuildRules {
-		rule := &w.config.BuildRules[i]
-		if w.shouldTriggerBuild(event.Name, rule) {
-			w.debounceBuild(rule)
+	for i := range rules {
+		rule := &rules[i]
+		if event.Op&ruleEvents(rule) != 0 && w.shouldTriggerBuild(event.Name, rule) && !generatedBy(rule, event.Name) {
+			self := w.duringOwnBuild(rule)
+			if w.paused(rule, self) {
+				continue
+			}
+			w.debounceBuild(rule, event.Name, self)
 		}
 	}
 }
 
-// shouldTriggerBuild checks if a file change should trigger a build rule
-func (w *Watcher) shouldTriggerBuild(filename string, rule *config.BuildRule) bool {
-	relativePath, err := filepath.Rel(".", filename)
-	if err != nil {
-		relativePath = filename
+// ruleEvents returns the file operations that trigger a rule (write and create by default).
+// Rules that only run on startup aren't triggered by any.
+func ruleEvents(rule *config.BuildRule) fsnotify.Op {
+	if rule.InitialOnly {
+		return 0
+	}
+	if len(rule.Events) == 0 {
+		return fsnotify.Write | fsnotify.Create
 	}
 
-	for _, pattern := range rule.Watch {
-		if w.matchesPattern(relativePath, pattern) {
-			return true
+	var ops fsnotify.Op
+	for _, event := range rule.Events {
+		switch event {
+		case config.EventWrite:
+			ops |= fsnotify.Write
+		case config.EventCreate:
+			ops |= fsnotify.Create
+		case config.EventRemove:
+			ops |= fsnotify.Remove
+		case config.EventRename:
+			ops |= fsnotify.Rename
+		case config.EventChmod:
+			ops |= fsnotify.Chmod
 		}
 	}
-	return false
+	return ops
 }
 
-// matchesPattern checks if a file path matches a glob pattern (including ** support)
-func (w *Watcher) matchesPattern(path, pattern string) bool {
-	// Handle simple patterns without **
-	if !strings.Contains(pattern, "**") {
-		matched, err := filepath.Match(pattern, path)
-		return err == nil && matched
+// logFileChange logs a changed file, summarizing instead once too many changes arrive within a short window
+func (w *Watcher) logFileChange(name string) {
+	w.changeLogMu.Lock()
+	defer w.changeLogMu.Unlock()
+
+	if w.changeLogTimer == nil {
+		w.changeLogTimer = w.clock.AfterFunc(changeLogWindow, w.flushChangeLog)
 	}
 
-	// Handle ** patterns - split on ** and match each part
-	parts := strings.Split(pattern, "**/")
-	if len(parts) == 1 {
-		// Pattern ends with ** (like "src/**")
-		prefix := strings.TrimSuffix(parts[0], "**")
-		return strings.HasPrefix(path, prefix)
+	w.changeLogCount++
+	if w.changeLogCount > changeLogLimit {
+		w.changeLogSuppressed++
+		return
 	}
 
-	// Pattern has ** in the middle (like "**/**.go")
-	if len(parts) == 2 {
-		prefix := parts[0]
-		suffix := parts[1]
+	logger.Printf("[watcher] File changed: %s\n", name)
+}
 
-		// Check if path starts with prefix (if any) and ends with suffix pattern
-		if prefix != "" && !strings.HasPrefix(path, prefix) {
-			return false
-		}
+// flushChangeLog ends the current rate limit window and summarizes any suppressed changes
+func (w *Watcher) flushChangeLog() {
+	w.changeLogMu.Lock()
+	defer w.changeLogMu.Unlock()
 
-		// Check if the remaining path matches the suffix pattern
-		pathToCheck := path
-		if prefix != "" {
-			pathToCheck = strings.TrimPrefix(path, prefix)
-			pathToCheck = strings.TrimPrefix(pathToCheck, "/")
-		}
+	if w.changeLogSuppressed > 0 {
+		logger.Printf("[watcher] %d files changed (%d not listed)\n", w.changeLogCount, w.changeLogSuppressed)
+	}
 
-		// Handle suffix pattern matching
-		if suffix == "" {
-			return true // Pattern is just "prefix/**"
-		}
+	w.changeLogCount = 0
+	w.changeLogSuppressed = 0
+	w.changeLogTimer = nil
+}
 
-		// Check if any part of the path matches the suffix
-		pathParts := strings.Split(pathToCheck, string(filepath.Separator))
-		for i := range pathParts {
-			subPath := filepath.Join(pathParts[i:]...)
-			matched, err := filepath.Match(suffix, subPath)
-			if err == nil && matched {
-				return true
-			}
+// shouldTriggerBuild checks if a file change should trigger a build rule. pattern.Match
+// decides extension filters like "**/*.go" from the file name alone.
+func (w *Watcher) shouldTriggerBuild(filename string, rule *config.BuildRule) bool {
+	relativePath, err := filepath.Rel(".", filename)
+	if err != nil {
+		relativePath = filename
+	}
+
+	for _, file := range rule.Files {
+		if filepath.Clean(file) == relativePath {
+			return true
 		}
+	}
 
-		// Also check the full remaining path
-		matched, err := filepath.Match(suffix, pathToCheck)
-		return err == nil && matched
+	for _, p := range rule.Watch {
+		if pattern.Match(relativePath, p) {
+			return true
+		}
 	}
+	return false
+}
 
-	// More complex ** patterns - fallback to simple matching
-	simplePattern := strings.ReplaceAll(pattern, "**/", "")
-	matched, err := filepath.Match(simplePattern, filepath.Base(path))
-	return err == nil && matched
+// ruleNames returns the names of rules, in order
+func ruleNames(rules []config.BuildRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
 }
 
-// debounceBuild implements debouncing to avoid rapid successive builds
-func (w *Watcher) debounceBuild(rule *config.BuildRule) {
+// debounceBuild implements debouncing to avoid rapid successive builds, collecting the
+// changed files until the build fires. self tells whether the change came during or just
+// after the rule's own build.
+func (w *Watcher) debounceBuild(rule *config.BuildRule, filename string, self bool) {
 	w.debounceMu.Lock()
 	defer w.debounceMu.Unlock()
 
+	files, pending := w.debounceFiles[rule.Name]
+	if pending {
+		self = self && w.debounceSelf[rule.Name]
+	} else {
+		files = newFileSet()
+		w.debounceFiles[rule.Name] = files
+	}
+	w.debounceSelf[rule.Name] = self
+	files.add(filename)
+	w.buildStore.QueueRule(rule.Name, "")
+
 	// Cancel existing timer for this rule
 	if timer, exists := w.debounceTimer[rule.Name]; exists {
 		timer.Stop()
 	}
 
 	// Set new timer
-	w.debounceTimer[rule.Name] = time.AfterFunc(w.debounceDelay, func() {
-		w.executeBuild(rule)
+	name := rule.Name
+	var timer Timer
+	timer = w.clock.AfterFunc(w.delayFor(rule), func() {
+		w.debounceMu.Lock()
+		if w.debounceTimer[name] != timer {
+			w.debounceMu.Unlock()
+			return // Superseded by a newer change
+		}
+		delete(w.debounceTimer, name)
+		files, self := w.debounceFiles[name], w.debounceSelf[name]
+		delete(w.debounceFiles, name)
+		delete(w.debounceSelf, name)
+		w.debounceMu.Unlock()
+
+		w.triggerBuild(&pendingBuild{name: name, files: files.list, selfTriggered: self})
 	})
+	w.debounceTimer[rule.Name] = timer
+}
+
+// delayFor returns the debounce delay for rule. Must be called with w.debounceMu held.
+func (w *Watcher) delayFor(rule *config.BuildRule) time.Duration {
+	if !w.config.AdaptiveDebounce {
+		return w.debounceDelay
+	}
+	if delay, ok := w.adaptiveDelay[rule.Name]; ok {
+		return delay
+	}
+	return w.config.DebounceMin
+}
+
+// adaptDebounce grows a rule's debounce delay when a build is aborted by a newer change
+// (rapid saves) and shrinks it back towards debounce_min when a build runs to completion
+func (w *Watcher) adaptDebounce(rule *config.BuildRule, aborted bool) {
+	if !w.config.AdaptiveDebounce {
+		return
+	}
+
+	w.debounceMu.Lock()
+	defer w.debounceMu.Unlock()
+
+	delay := w.delayFor(rule)
+	if aborted {
+		delay = min(delay*3/2, w.config.DebounceMax)
+	} else {
+		delay = max(delay*2/3, w.config.DebounceMin)
+	}
+	if delay != w.delayFor(rule) {
+		logger.Printf("[watcher] Debounce for %s is now %s\n", rule.Name, delay.Round(time.Millisecond))
+	}
+	w.adaptiveDelay[rule.Name] = delay
+}
+
+// triggerBuild runs a debounced build, holding it back while a git operation is in progress
+func (w *Watcher) triggerBuild(pb *pendingBuild) {
+	if !w.config.PauseOnGit || !w.gitOperationInProgress() {
+		w.executeBuild(pb)
+		return
+	}
+
+	w.gitMu.Lock()
+	defer w.gitMu.Unlock()
+
+	// The first held back build starts polling for the git operation to finish
+	if len(w.gitPending) == 0 {
+		logger.Printf("[watcher] Git operation in progress, pausing builds\n")
+		go w.waitForGit()
+	}
+	if held, exists := w.gitPending[pb.name]; exists {
+		pb.selfTriggered = pb.selfTriggered && held.selfTriggered
+		files := newFileSet(pb.files...)
+		for _, file := range held.files {
+			files.add(file)
+		}
+		pb.files = files.list
+	}
+	w.gitPending[pb.name] = pb
+	w.buildStore.QueueRule(pb.name, "git")
+}
+
+// gitOperationInProgress checks whether the git lock file exists
+func (w *Watcher) gitOperationInProgress() bool {
+	_, err := os.Stat(w.config.GitLockFile)
+	return err == nil
+}
+
+// waitForGit polls until the git operation has finished, then runs each held back build once
+func (w *Watcher) waitForGit() {
+	for w.gitOperationInProgress() {
+		w.wait(gitPollInterval, nil)
+	}
+
+	w.gitMu.Lock()
+	pending := w.gitPending
+	w.gitPending = make(map[string]*pendingBuild)
+	w.gitMu.Unlock()
+
+	logger.Printf("[watcher] Git operation finished, resuming builds\n")
+	for _, pb := range pending {
+		w.executeBuild(pb)
+	}
 }
 
 // executeBuild runs a build rule, aborting any existing build for the same rule
-func (w *Watcher) executeBuild(rule *config.BuildRule) {
+func (w *Watcher) executeBuild(pb *pendingBuild) {
+	rule := w.rule(pb.name)
+	if rule == nil {
+		logger.Printf("[watcher] Skipping build of removed rule: %s\n", pb.name)
+		return
+	}
+
+	// In rerun mode the run command rebuilds itself, so just restart it
+	if w.config.RunMode == config.RunModeRerun {
+		logger.Printf("[watcher] Triggering rerun: %s\n", rule.Name)
+		w.buildStore.SettleRule(rule.Name)
+		if w.rerunCallback != nil {
+			w.rerunCallback()
+		}
+		return
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	logger.Printf("[watcher] Triggering build: %s\n", rule.Name)
+	// A build whose when_cmd passed is either started or held back below
+	if pb.guarded {
+		delete(w.guarding, rule.Name)
+	}
+
+	// Wait for dependencies that are about to run or still running
+	if dep := w.busyDependency(rule); dep != "" {
+		logger.Printf("[watcher] %s waiting for dependency: %s\n", rule.Name, dep)
+		w.blocked[rule.Name] = pb
+		w.buildStore.QueueRule(rule.Name, dep)
+		return
+	}
+	delete(w.blocked, rule.Name)
+
+	// Wait for rules this one must not build alongside
+	if other := w.busySerialized(rule); other != "" {
+		logger.Printf("[watcher] %s waiting for %s to finish (serialize_with)\n", rule.Name, other)
+		w.serialized[rule.Name] = pb
+		w.buildStore.QueueRule(rule.Name, other)
+		return
+	}
+	delete(w.serialized, rule.Name)
+
+	// Changes from before a rule was paused after failing don't retry it
+	if w.failedTooOften(rule) {
+		logger.Printf("[watcher] Skipping paused rule: %s\n", rule.Name)
+		w.buildStore.SettleRule(rule.Name)
+		return
+	}
+
+	// Check when_cmd once nothing else holds the build back, without blocking other rules
+	if rule.WhenCmd != "" && !pb.guarded {
+		w.guarding[rule.Name] = true
+		go w.checkGuard(rule, pb)
+		return
+	}
+
+	// Don't let a rule that keeps triggering itself build forever
+	if w.detectLoop(rule, pb.selfTriggered) {
+		w.buildStore.SettleRule(rule.Name)
+		return
+	}
+
+	triggeredBy := relativePaths(pb.files)
+	if len(triggeredBy) > 0 {
+		logger.Printf("[watcher] Triggering build: %s (changed: %s)\n", rule.Name, summarizeFiles(triggeredBy))
+	} else {
+		logger.Printf("[watcher] Triggering build: %s\n", rule.Name)
+	}
 
 	// Check if there's already a running build for this rule
 	if runningBuild, exists := w.runningBuilds[rule.Name]; exists {
 		logger.Printf("[watcher] Aborting previous build: %s\n", rule.Name)
 		w.abortBuild(runningBuild)
+		w.adaptDebounce(rule, true)
 	}
 
 	// Start new build
 	ctx, cancel := context.WithCancel(context.Background())
-	tracker := build.NewTracker(w.config.BuildStatusDir, w.config.DebugMode)
+	tracker := build.NewTracker(w.buildStore, w.config.BuildStatusDir, rule.Name, w.config.KeepStatus)
+	tracker.SetTriggeredBy(triggeredBy)
 
 	// Start tracking
 	if err := tracker.Start(); err != nil {
-		logger.Printf("[watcher] Failed to start build tracking: %v\n", err)
+		logger.Errorf("[watcher] Failed to start build tracking: %v\n", err)
+		w.buildStore.SettleRule(rule.Name)
 		cancel()
 		return
 	}
 
-	// Create command
-	cmd := exec.CommandContext(ctx, "sh", "-c", rule.Command)
-	cmd.Stdout = logger.NewPrefixWriter(fmt.Sprintf("[build:%s] ", rule.Name), os.Stdout)
-	cmd.Stderr = logger.NewPrefixWriter(fmt.Sprintf("[build:%s] ", rule.Name), os.Stderr)
-
 	runningBuild := &RunningBuild{
 		Rule:    rule,
-		Process: cmd,
 		Tracker: tracker,
 		Cancel:  cancel,
 		BuildID: tracker.GetBuildID(),
+		Output:  &build.OutputBuffer{},
+
+		command: w.commandFor(rule, pb.files),
+		ctx:     ctx,
+	}
+	if rule.Container != nil {
+		runningBuild.Container = "godevwatch-" + tracker.GetBuildID()
 	}
 
 	w.runningBuilds[rule.Name] = runningBuild
@@ -321,52 +902,489 @@ func (w *Watcher) executeBuild(rule *config.BuildRule) {
 	go w.runBuildProcess(runningBuild)
 }
 
+// checkGuard runs the rule's when_cmd and starts the build if it passes. A failed when_cmd
+// skips the build; rules waiting on it go ahead as if it had built.
+func (w *Watcher) checkGuard(rule *config.BuildRule, pb *pendingBuild) {
+	if build.GuardPasses(rule) {
+		pb.guarded = true
+		w.executeBuild(pb)
+		return
+	}
+
+	w.mu.Lock()
+	delete(w.guarding, rule.Name)
+	w.mu.Unlock()
+	w.buildStore.SettleRule(rule.Name)
+	w.releaseDependents(rule.Name, true)
+}
+
+// maxLoggedFiles caps how many changed files are listed when a build is triggered
+const maxLoggedFiles = 5
+
+// relativePaths returns files relative to the project directory
+func relativePaths(files []string) []string {
+	relative := make([]string, 0, len(files))
+	for _, file := range files {
+		if rel, err := filepath.Rel(".", file); err == nil {
+			file = rel
+		}
+		relative = append(relative, file)
+	}
+	return relative
+}
+
+// summarizeFiles lists files for a log line, summarizing the rest after maxLoggedFiles
+func summarizeFiles(files []string) string {
+	if len(files) <= maxLoggedFiles {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:maxLoggedFiles], ", "), len(files)-maxLoggedFiles)
+}
+
+// commandFor picks the command to run for the changed files: the first case (in config order)
+// whose pattern matches any of the files wins, otherwise the rule's own command is used
+func (w *Watcher) commandFor(rule *config.BuildRule, files []string) config.Commands {
+	for _, c := range rule.Cases {
+		for _, file := range files {
+			relativePath, err := filepath.Rel(".", file)
+			if err != nil {
+				relativePath = file
+			}
+			if pattern.Match(relativePath, c.When) {
+				logger.Printf("[watcher] %s: using case %q for %s\n", rule.Name, c.When, relativePath)
+				return withStep(c.Command)
+			}
+		}
+	}
+	return withStep(rule.Command)
+}
+
+// withStep returns command, or a single empty step (which succeeds) if it has none, so every
+// build has a first process
+func withStep(command config.Commands) config.Commands {
+	if len(command) == 0 {
+		return config.Commands{""}
+	}
+	return command
+}
+
 // runBuildProcess executes the build in a goroutine
 func (w *Watcher) runBuildProcess(rb *RunningBuild) {
+	succeeded := false
 	defer func() {
+		// An aborted build may already have been replaced by a newer one
 		w.mu.Lock()
-		delete(w.runningBuilds, rb.Rule.Name)
+		current := w.runningBuilds[rb.Rule.Name] == rb
+		if current {
+			delete(w.runningBuilds, rb.Rule.Name)
+			w.lastFinished[rb.Rule.Name] = w.clock.Now()
+		}
 		w.mu.Unlock()
 		rb.Cancel()
+
+		if current {
+			w.releaseSerialized(rb.Rule)
+			w.releaseDependents(rb.Rule.Name, succeeded)
+			w.adaptDebounce(rb.Rule, false)
+		}
 	}()
 
-	// Run the command
-	err := rb.Process.Run()
+	// Generated code must be in place before the command runs
+	err := w.generate(rb)
+	if err == nil {
+		err = w.runAttempts(rb)
+	}
 
-	if err != nil {
-		// Check if it was canceled (aborted)
-		if rb.Process.ProcessState != nil && rb.Process.ProcessState.Exited() {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				// Check if process was killed (aborted)
-				if exitError.ExitCode() == -1 ||
-					(exitError.ProcessState.Sys().(syscall.WaitStatus)).Signal() == syscall.SIGKILL ||
-					(exitError.ProcessState.Sys().(syscall.WaitStatus)).Signal() == syscall.SIGTERM {
-					// This was an abort, not a failure
-					return
-				}
-			}
-		}
+	// An aborted build was killed on purpose, that's not a failure. abortBuild cancels the
+	// context under w.mu, so checking it under the lock settles whether the build finishes
+	// or is aborted.
+	w.mu.Lock()
+	if rb.ctx.Err() != nil {
+		w.mu.Unlock()
+		return
+	}
 
+	if err != nil {
 		// This was a genuine failure
 		logger.Printf("[watcher] Build failed: %s - %v\n", rb.Rule.Name, err)
+		rb.Tracker.Diagnose(rb.Rule.Parser, rb.Output.Bytes())
 		if err := rb.Tracker.Fail(); err != nil {
-			logger.Printf("[watcher] Failed to mark build as failed: %v\n", err)
+			logger.Errorf("[watcher] Failed to mark build as failed: %v\n", err)
+		}
+		w.mu.Unlock()
+		w.recordFailure(rb.Rule)
+
+		// Call failure callback if set
+		if w.buildFailureCallback != nil {
+			w.buildFailureCallback(rb.Rule.Name, err)
 		}
 		return
 	}
 
+	succeeded = true
+	delete(w.failureStreak, rb.Rule.Name)
+
 	// Build succeeded
 	logger.Printf("[watcher] Build completed: %s\n", rb.Rule.Name)
 	if err := rb.Tracker.Complete(); err != nil {
-		logger.Printf("[watcher] Failed to mark build as complete: %v\n", err)
+		logger.Errorf("[watcher] Failed to mark build as complete: %v\n", err)
 	}
+	w.mu.Unlock()
 
 	// Call success callback if set
 	if w.buildSuccessCallback != nil {
-		w.buildSuccessCallback()
+		w.buildSuccessCallback(rb.Rule.Name)
 	}
 }
 
+// runAttempts runs the build's command, retrying a failure up to Retries times
+func (w *Watcher) runAttempts(rb *RunningBuild) error {
+	for attempt := 1; ; attempt++ {
+		// A command that can't be created fails the build like one that doesn't succeed
+		cmd, output, err := buildCommand(rb, attempt)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		rb.Process, rb.Output = cmd, output
+		w.mu.Unlock()
+
+		// Run the command steps
+		err = w.runSteps(rb, attempt)
+		if rb.ctx.Err() != nil {
+			return err
+		}
+
+		// Let the rule's output patterns override the exit status
+		err = build.CheckOutput(rb.Rule, rb.Output.Bytes(), err)
+		if err == nil || attempt > rb.Rule.Retries {
+			return err
+		}
+
+		logger.Warnf("[watcher] \033[33mBuild failed: %s - %v (retrying in %s, attempt %d/%d)\033[0m\n",
+			rb.Rule.Name, err, rb.Rule.RetryDelay, attempt+1, rb.Rule.Retries+1)
+		if !w.wait(rb.Rule.RetryDelay, rb.ctx.Done()) {
+			return err
+		}
+	}
+}
+
+// generate runs the rule's generate steps before its command
+func (w *Watcher) generate(rb *RunningBuild) error {
+	if len(rb.Rule.Generate) == 0 {
+		return nil
+	}
+
+	output := &build.OutputBuffer{}
+	if err := build.Generate(rb.ctx, rb.Rule, rb.Container, output); err != nil {
+		// Failures are diagnosed from the generate output
+		w.mu.Lock()
+		rb.Output = output
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// generatedBy reports whether a changed file matches one of the rule's generate_outputs,
+// which never trigger the rule itself
+func generatedBy(rule *config.BuildRule, filename string) bool {
+	if len(rule.GenerateOutputs) == 0 {
+		return false
+	}
+	relativePath, err := filepath.Rel(".", filename)
+	if err != nil {
+		relativePath = filename
+	}
+	for _, p := range rule.GenerateOutputs {
+		if pattern.Match(relativePath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// runSteps runs the build's command steps in order, starting with the already created
+// rb.Process for the first one, and stops at the first step that fails
+func (w *Watcher) runSteps(rb *RunningBuild, attempt int) error {
+	steps := len(rb.command)
+	for i := 0; ; i++ {
+		if steps > 1 {
+			logger.Printf("[watcher] %s: step %d/%d: %s\n", rb.Rule.Name, i+1, steps, rb.command[i])
+		}
+		if err := rb.Process.Run(); err != nil {
+			return build.StepError(rb.command, i, err)
+		}
+		if i+1 == steps || rb.ctx.Err() != nil {
+			return nil
+		}
+
+		cmd, err := stepCommand(rb, i+1, attempt, rb.Output)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		rb.Process = cmd
+		w.mu.Unlock()
+	}
+}
+
+// buildCommand creates the command for the first step of an attempt of a build, streaming its
+// output into a new buffer
+func buildCommand(rb *RunningBuild, attempt int) (*exec.Cmd, *build.OutputBuffer, error) {
+	output := &build.OutputBuffer{}
+	cmd, err := stepCommand(rb, 0, attempt, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cmd, output, nil
+}
+
+// stepCommand creates the command for a step of a build, streaming its output through the
+// logger (retries show the attempt in the prefix) into output
+func stepCommand(rb *RunningBuild, step, attempt int, output *build.OutputBuffer) (*exec.Cmd, error) {
+	cmd, err := build.Command(rb.ctx, rb.Rule, rb.command[step], rb.Container)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("[build:%s] ", rb.Rule.Name)
+	if attempt > 1 {
+		prefix = fmt.Sprintf("[build:%s %d/%d] ", rb.Rule.Name, attempt, rb.Rule.Retries+1)
+	}
+	cmd.Stdout = io.MultiWriter(logger.NewPrefixWriter(prefix, os.Stdout, logger.BuildLog), output)
+	cmd.Stderr = io.MultiWriter(logger.NewPrefixWriter(prefix, os.Stderr, logger.BuildLog), output)
+	return cmd, nil
+}
+
+// busyDependency returns the name of a dependency of rule that is pending or running, if any.
+// Must be called with w.mu held.
+func (w *Watcher) busyDependency(rule *config.BuildRule) string {
+	w.debounceMu.Lock()
+	defer w.debounceMu.Unlock()
+
+	for _, dep := range rule.DependsOn {
+		if _, running := w.runningBuilds[dep]; running {
+			return dep
+		}
+		if _, pending := w.debounceTimer[dep]; pending {
+			return dep
+		}
+		if _, waiting := w.blocked[dep]; waiting {
+			return dep
+		}
+		if w.guarding[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// busySerialized returns the name of a running rule that rule is serialized with, if any.
+// Must be called with w.mu held.
+func (w *Watcher) busySerialized(rule *config.BuildRule) string {
+	for name, running := range w.runningBuilds {
+		if serializedWith(rule, name) || serializedWith(running.Rule, rule.Name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// serializedWith reports whether rule lists other in serialize_with
+func serializedWith(rule *config.BuildRule, other string) bool {
+	for _, name := range rule.SerializeWith {
+		if name == other {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseSerialized runs builds that were waiting for the given rule to finish
+func (w *Watcher) releaseSerialized(finished *config.BuildRule) {
+	w.mu.Lock()
+	var ready []*pendingBuild
+	for waitingName, waiting := range w.serialized {
+		// executeBuild drops the build if its rule was removed in the meantime
+		waitingRule := w.rule(waitingName)
+		if waitingRule == nil || serializedWith(waitingRule, finished.Name) || serializedWith(finished, waitingName) {
+			ready = append(ready, waiting)
+			delete(w.serialized, waitingName)
+		}
+	}
+	w.mu.Unlock()
+
+	// executeBuild makes the rule wait again if another rule it is serialized with is running
+	for _, pb := range ready {
+		w.executeBuild(pb)
+	}
+}
+
+// releaseDependents runs builds that were waiting on the given rule, or drops them if it failed
+func (w *Watcher) releaseDependents(name string, succeeded bool) {
+	w.mu.Lock()
+	var ready []*pendingBuild
+	for dependentName, dependent := range w.blocked {
+		dependentRule := w.rule(dependentName)
+		if dependentRule == nil {
+			delete(w.blocked, dependentName)
+			continue
+		}
+		for _, dep := range dependentRule.DependsOn {
+			if dep != name {
+				continue
+			}
+			if !succeeded {
+				logger.Printf("[watcher] Skipping %s: dependency %s did not succeed\n", dependentName, name)
+				delete(w.blocked, dependentName)
+				w.buildStore.SettleRule(dependentName)
+			} else {
+				ready = append(ready, dependent)
+			}
+			break
+		}
+	}
+	w.mu.Unlock()
+
+	// executeBuild blocks the rule again if it still has other busy dependencies
+	for _, pb := range ready {
+		w.executeBuild(pb)
+	}
+}
+
+// detectLoop records a build of the rule and reports whether the rule is paused as a rebuild
+// loop. Only builds triggered by changes during or just after the rule's own build count; any
+// other change starts the count over. Must be called with w.mu held.
+func (w *Watcher) detectLoop(rule *config.BuildRule, selfTriggered bool) bool {
+	if w.looping[rule.Name] {
+		logger.Printf("[watcher] Skipping %s: paused as a rebuild loop\n", rule.Name)
+		return true
+	}
+	if w.config.LoopLimit < 0 {
+		return false
+	}
+	if !selfTriggered {
+		delete(w.recentBuilds, rule.Name)
+		return false
+	}
+
+	// Slide the window forward
+	now := w.clock.Now()
+	recent := w.recentBuilds[rule.Name][:0]
+	for _, started := range w.recentBuilds[rule.Name] {
+		if now.Sub(started) < w.config.LoopWindow {
+			recent = append(recent, started)
+		}
+	}
+	recent = append(recent, now)
+	w.recentBuilds[rule.Name] = recent
+
+	if len(recent) <= w.config.LoopLimit {
+		return false
+	}
+
+	w.looping[rule.Name] = true
+	delete(w.recentBuilds, rule.Name)
+	logger.Warnf("[watcher] \033[33mRule %s appears to be rebuilding in a loop (%d builds in %s); check that its output isn't being watched. The rule is paused until the config is fixed and reloaded, or a rebuild is forced, with SIGHUP.\033[0m\n",
+		rule.Name, len(recent), w.config.LoopWindow)
+	return true
+}
+
+// duringOwnBuild reports whether the rule is building or finished building within loopSettle,
+// in which case a change may have been written by the build itself
+func (w *Watcher) duringOwnBuild(rule *config.BuildRule) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if _, running := w.runningBuilds[rule.Name]; running {
+		return true
+	}
+	finished, ok := w.lastFinished[rule.Name]
+	return ok && w.clock.Now().Sub(finished) < loopSettle
+}
+
+// RebuildAll builds every rule straight away, in dependency order, without waiting for a
+// file change or the debounce delay. Paused rules are resumed first.
+func (w *Watcher) RebuildAll() {
+	w.Resume()
+
+	// In rerun mode the run command rebuilds itself, so restart it once
+	if w.config.RunMode == config.RunModeRerun {
+		logger.Printf("[watcher] Triggering rerun\n")
+		if w.rerunCallback != nil {
+			w.rerunCallback()
+		}
+		return
+	}
+
+	current := config.Config{BuildRules: w.buildRules()}
+	rules, err := current.OrderedRules()
+	if err != nil {
+		logger.Errorf("[watcher] Cannot rebuild: %v\n", err)
+		return
+	}
+
+	// Dependents started after their dependencies wait for them to finish
+	for i := range rules {
+		w.executeBuild(&pendingBuild{name: rules[i].Name})
+	}
+}
+
+// Resume unpauses rules that were paused as rebuild loops or after failing too often
+func (w *Watcher) Resume() {
+	rules := w.buildRules()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for name := range w.looping {
+		logger.Printf("[watcher] Resuming rule: %s\n", name)
+	}
+	for i := range rules {
+		if w.failedTooOften(&rules[i]) && !w.looping[rules[i].Name] {
+			logger.Printf("[watcher] Resuming rule: %s\n", rules[i].Name)
+		}
+	}
+	w.looping = make(map[string]bool)
+	w.recentBuilds = make(map[string][]time.Time)
+	w.failureStreak = make(map[string]int)
+}
+
+// recordFailure counts a consecutive failure and announces when the rule gets paused
+func (w *Watcher) recordFailure(rule *config.BuildRule) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.failureStreak[rule.Name]++
+	if rule.MaxFailureStreak > 0 && w.failureStreak[rule.Name] == rule.MaxFailureStreak {
+		logger.Warnf("[watcher] %s paused after %d failures; save again to retry\n", rule.Name, rule.MaxFailureStreak)
+	}
+}
+
+// failedTooOften reports whether the rule has failed max_failure_streak times in a row.
+// Must be called with w.mu held.
+func (w *Watcher) failedTooOften(rule *config.BuildRule) bool {
+	return rule.MaxFailureStreak > 0 && w.failureStreak[rule.Name] >= rule.MaxFailureStreak
+}
+
+// paused reports whether changes to a rule's files are ignored because it failed too often.
+// A change the rule's own build didn't write resumes it with a fresh failure streak.
+func (w *Watcher) paused(rule *config.BuildRule, self bool) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.failedTooOften(rule) {
+		return false
+	}
+	if self {
+		return true
+	}
+	logger.Printf("[watcher] Retrying paused rule: %s\n", rule.Name)
+	delete(w.failureStreak, rule.Name)
+	return false
+}
+
 // abortBuild terminates a running build and marks it as aborted
 func (w *Watcher) abortBuild(rb *RunningBuild) {
 	// Cancel the context
@@ -375,16 +1393,19 @@ func (w *Watcher) abortBuild(rb *RunningBuild) {
 	// Kill the process if it's still running
 	if rb.Process != nil && rb.Process.Process != nil {
 		if err := rb.Process.Process.Kill(); err != nil {
-			logger.Printf("[watcher] Failed to kill process: %v\n", err)
+			logger.Errorf("[watcher] Failed to kill process: %v\n", err)
 		}
 	}
+	if rb.Container != "" {
+		build.StopContainer(rb.Container)
+	}
 
 	// Mark as aborted
 	if err := rb.Tracker.Abort(); err != nil {
-		fmt.Printf("[watcher] Failed to mark build as aborted: %v\n", err)
+		logger.Errorf("[watcher] Failed to mark build as aborted: %v\n", err)
 	}
 
-	fmt.Printf("[watcher] Aborted build: %s\n", rb.Rule.Name)
+	logger.Infof("[watcher] Aborted build: %s\n", rb.Rule.Name)
 }
 
 // stopAllBuilds aborts all running builds
@@ -397,32 +1418,82 @@ func (w *Watcher) stopAllBuilds() {
 	}
 }
 
-// shouldIgnoreDirectory checks if a directory should be ignored based on rule patterns
-func (w *Watcher) shouldIgnoreDirectory(dir string, rule *config.BuildRule) bool {
+// matchesDirectory checks if a directory matches any of the given ignore patterns
+func (w *Watcher) matchesDirectory(dir string, patterns []string) bool {
 	relativePath, err := filepath.Rel(".", dir)
 	if err != nil {
 		relativePath = dir
 	}
 
-	for _, pattern := range rule.Ignore {
-		if w.matchesPattern(relativePath, pattern) || w.matchesPattern(relativePath+"/", pattern) {
+	for _, p := range patterns {
+		if pattern.Match(relativePath, p) || pattern.Match(relativePath+"/", p) {
 			return true
 		}
 	}
 	return false
 }
 
-// shouldIgnoreFile checks if a file should be ignored based on any rule's ignore patterns
+// isTempFile reports whether a file's name matches one of the temp_file_patterns
+func (w *Watcher) isTempFile(filename string) bool {
+	w.configMu.RLock()
+	patterns := w.tempFiles
+	w.configMu.RUnlock()
+
+	name := filepath.Base(filename)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// explicitlyWatched reports whether a rule names the file itself rather than matching it with a
+// wildcard: it is listed in files, or matches a watch pattern whose file name part starts with a
+// literal character (".env", "config/.*.yaml" but not "**/*")
+func (w *Watcher) explicitlyWatched(filename string) bool {
+	relativePath, err := filepath.Rel(".", filename)
+	if err != nil {
+		relativePath = filename
+	}
+
+	for _, rule := range w.buildRules() {
+		for _, file := range rule.Files {
+			if filepath.Clean(file) == relativePath {
+				return true
+			}
+		}
+		for _, p := range rule.Watch {
+			base := filepath.Base(p)
+			if strings.ContainsAny(base[:1], "*?[") {
+				continue
+			}
+			if pattern.Match(relativePath, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shouldIgnoreFile checks if a file should be ignored based on the global or any rule's ignore patterns
 func (w *Watcher) shouldIgnoreFile(filename string) bool {
 	relativePath, err := filepath.Rel(".", filename)
 	if err != nil {
 		relativePath = filename
 	}
 
+	// Globally ignored files are ignored for every rule
+	for _, p := range w.globalIgnores() {
+		if pattern.Match(relativePath, p) {
+			return true
+		}
+	}
+
 	// Check against all rules' ignore patterns
-	for _, rule := range w.config.BuildRules {
-		for _, pattern := range rule.Ignore {
-			if w.matchesPattern(relativePath, pattern) {
+	for _, rule := range w.buildRules() {
+		for _, p := range rule.Ignore {
+			if pattern.Match(relativePath, p) {
 				return true
 			}
 		}
@@ -431,6 +1502,39 @@ func (w *Watcher) shouldIgnoreFile(filename string) bool {
 }
 
 // SetBuildSuccessCallback sets the callback function to be called when a build succeeds
-func (w *Watcher) SetBuildSuccessCallback(callback func()) {
+func (w *Watcher) SetBuildSuccessCallback(callback func(rule string)) {
 	w.buildSuccessCallback = callback
 }
+
+// SetBuildFailureCallback sets the callback function to be called when a build fails
+func (w *Watcher) SetBuildFailureCallback(callback func(rule string, err error)) {
+	w.buildFailureCallback = callback
+}
+
+// SetRerunCallback sets the callback function to be called when a change is detected in rerun mode
+func (w *Watcher) SetRerunCallback(callback func()) {
+	w.rerunCallback = callback
+}
+
+// fileSet is a list of changed files without duplicates, in the order they first changed
+type fileSet struct {
+	list []string
+	seen map[string]bool
+}
+
+// newFileSet creates a fileSet of files
+func newFileSet(files ...string) *fileSet {
+	s := &fileSet{seen: make(map[string]bool, len(files))}
+	for _, file := range files {
+		s.add(file)
+	}
+	return s
+}
+
+// add appends file unless it is already in the set
+func (s *fileSet) add(file string) {
+	if !s.seen[file] {
+		s.seen[file] = true
+		s.list = append(s.list, file)
+	}
+}
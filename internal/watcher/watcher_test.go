@@ -0,0 +1,467 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kyco/godevwatch/internal/build"
+	"github.com/kyco/godevwatch/internal/config"
+)
+
+// fakeClock is a Clock that only moves when advanced. Calls scheduled with AfterFunc run
+// synchronously in Advance, in the order they are due.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward by d, running every call that becomes due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		switch {
+		case timer.stopped:
+		case !timer.at.After(c.now):
+			timer.stopped = true
+			due = append(due, timer)
+		default:
+			pending = append(pending, timer)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	pending := !t.stopped
+	t.stopped = true
+	return pending
+}
+
+// newTestWatcher returns a watcher for rules in rerun mode, so a build that fires just
+// settles the rule in the store and counts a rerun instead of running a command
+func newTestWatcher(t *testing.T, cfg *config.Config) (*Watcher, *fakeClock, *build.Store, func() int) {
+	t.Helper()
+	cfg.RunMode = config.RunModeRerun
+	store := build.NewStore()
+	w, err := NewWatcher(cfg, store)
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+	t.Cleanup(func() { w.fsWatcher.Close() })
+
+	clock := newFakeClock()
+	w.SetClock(clock)
+
+	var mu sync.Mutex
+	runs := 0
+	w.SetRerunCallback(func() {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+	})
+	return w, clock, store, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs
+	}
+}
+
+// ruleState returns the scheduling state the store reports for a rule
+func ruleState(store *build.Store, name string) string {
+	for _, state := range store.RuleStates() {
+		if state.Rule == name {
+			return state.State
+		}
+	}
+	return ""
+}
+
+func TestDebounceFiresOnce(t *testing.T) {
+	cfg := &config.Config{BuildRules: []config.BuildRule{{Name: "go-build"}}}
+	w, clock, store, runs := newTestWatcher(t, cfg)
+
+	w.debounceBuild(&cfg.BuildRules[0], "main.go", false)
+	if state := ruleState(store, "go-build"); state != build.RuleQueued {
+		t.Errorf("state after a change = %q, want %q", state, build.RuleQueued)
+	}
+
+	clock.Advance(99 * time.Millisecond)
+	if n := runs(); n != 0 {
+		t.Fatalf("build fired %d time(s) before the debounce delay passed", n)
+	}
+	clock.Advance(time.Millisecond)
+	if n := runs(); n != 1 {
+		t.Fatalf("build fired %d time(s) once the debounce delay passed, want 1", n)
+	}
+	clock.Advance(time.Second)
+	if n := runs(); n != 1 {
+		t.Errorf("build fired %d time(s) in total, want 1", n)
+	}
+	if state := ruleState(store, "go-build"); state != build.RuleIdle {
+		t.Errorf("state after the build = %q, want %q", state, build.RuleIdle)
+	}
+}
+
+func TestDebounceCollapsesRapidChanges(t *testing.T) {
+	cfg := &config.Config{BuildRules: []config.BuildRule{{Name: "go-build"}}}
+	w, clock, _, runs := newTestWatcher(t, cfg)
+
+	// Each change within the delay restarts it
+	for _, file := range []string{"a.go", "b.go", "a.go", "c.go", "b.go"} {
+		w.debounceBuild(&cfg.BuildRules[0], file, false)
+		clock.Advance(50 * time.Millisecond)
+	}
+	if n := runs(); n != 0 {
+		t.Fatalf("build fired %d time(s) while changes kept coming", n)
+	}
+	if files := w.debounceFiles["go-build"]; files == nil || len(files.list) != 3 {
+		t.Errorf("pending files = %v, want a.go, b.go and c.go once each", files)
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	if n := runs(); n != 1 {
+		t.Errorf("build fired %d time(s) after the changes stopped, want 1", n)
+	}
+	if _, pending := w.debounceFiles["go-build"]; pending {
+		t.Error("changed files still pending after the build fired")
+	}
+}
+
+func TestDebouncePerRuleDelay(t *testing.T) {
+	cfg := &config.Config{
+		AdaptiveDebounce: true,
+		DebounceMin:      100 * time.Millisecond,
+		DebounceMax:      time.Second,
+		BuildRules:       []config.BuildRule{{Name: "fast"}, {Name: "slow"}},
+	}
+	w, clock, store, runs := newTestWatcher(t, cfg)
+	w.adaptiveDelay["slow"] = 300 * time.Millisecond
+
+	w.debounceBuild(&cfg.BuildRules[0], "a.go", false)
+	w.debounceBuild(&cfg.BuildRules[1], "a.go", false)
+
+	clock.Advance(100 * time.Millisecond)
+	if n := runs(); n != 1 {
+		t.Fatalf("%d build(s) fired after 100ms, want only fast", n)
+	}
+	if fast, slow := ruleState(store, "fast"), ruleState(store, "slow"); fast != build.RuleIdle || slow != build.RuleQueued {
+		t.Errorf("after 100ms fast is %q and slow %q, want %q and %q", fast, slow, build.RuleIdle, build.RuleQueued)
+	}
+
+	clock.Advance(199 * time.Millisecond)
+	if n := runs(); n != 1 {
+		t.Fatalf("slow fired before its 300ms delay passed")
+	}
+	clock.Advance(time.Millisecond)
+	if n := runs(); n != 2 {
+		t.Errorf("%d build(s) fired after 300ms, want 2", n)
+	}
+}
+
+func TestAdaptiveDebounce(t *testing.T) {
+	cfg := &config.Config{
+		AdaptiveDebounce: true,
+		DebounceMin:      100 * time.Millisecond,
+		DebounceMax:      200 * time.Millisecond,
+		BuildRules:       []config.BuildRule{{Name: "go-build"}},
+	}
+	w, clock, _, runs := newTestWatcher(t, cfg)
+	rule := &cfg.BuildRules[0]
+
+	// Aborted builds grow the delay up to debounce_max, completed ones shrink it again
+	w.adaptDebounce(rule, true)
+	if delay := w.adaptiveDelay["go-build"]; delay != 150*time.Millisecond {
+		t.Errorf("delay after an aborted build = %s, want 150ms", delay)
+	}
+	w.adaptDebounce(rule, true)
+	if delay := w.adaptiveDelay["go-build"]; delay != 200*time.Millisecond {
+		t.Errorf("delay after two aborted builds = %s, want 200ms", delay)
+	}
+
+	w.debounceBuild(rule, "main.go", false)
+	clock.Advance(199 * time.Millisecond)
+	if n := runs(); n != 0 {
+		t.Fatalf("build fired before the grown delay passed")
+	}
+	clock.Advance(time.Millisecond)
+	if n := runs(); n != 1 {
+		t.Fatalf("build fired %d time(s) after the grown delay, want 1", n)
+	}
+
+	w.adaptDebounce(rule, false)
+	w.adaptDebounce(rule, false)
+	if delay := w.adaptiveDelay["go-build"]; delay != 100*time.Millisecond {
+		t.Errorf("delay after two completed builds = %s, want debounce_min", delay)
+	}
+}
+
+func TestCommandErrorFailsBuild(t *testing.T) {
+	// A rule running in a container can't create its command without docker
+	t.Setenv("PATH", t.TempDir())
+	cfg := &config.Config{
+		BuildStatusDir: t.TempDir(),
+		BuildRules: []config.BuildRule{
+			{Name: "generate", Container: &config.Container{Image: "golang"}},
+			{Name: "go-build", DependsOn: []string{"generate"}},
+		},
+	}
+	w, clock, store, _ := newTestWatcher(t, cfg)
+	cfg.RunMode = config.RunModeBuild
+
+	failed := make(chan string, 1)
+	w.SetBuildFailureCallback(func(rule string, err error) {
+		// The callback may call back into the watcher
+		w.mu.Lock()
+		w.mu.Unlock()
+		failed <- rule
+	})
+
+	w.debounceBuild(&cfg.BuildRules[0], "schema.sql", false)
+	w.debounceBuild(&cfg.BuildRules[1], "main.go", false)
+	clock.Advance(100 * time.Millisecond)
+
+	select {
+	case rule := <-failed:
+		if rule != "generate" {
+			t.Errorf("failure reported for %s, want generate", rule)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no failure reported for the command that couldn't be created")
+	}
+
+	// The dependent is skipped instead of waiting forever
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w.mu.Lock()
+		blocked, streak := len(w.blocked), w.failureStreak["generate"]
+		w.mu.Unlock()
+		if blocked == 0 && ruleState(store, "go-build") == build.RuleIdle {
+			if streak != 1 {
+				t.Errorf("failure streak of generate = %d, want 1", streak)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("go-build still blocked on its failed dependency (state %q)", ruleState(store, "go-build"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForBuilds waits until no build is running and the last one has finished its cleanup
+func waitForBuilds(t *testing.T, w *Watcher) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.RLock()
+		running := len(w.runningBuilds)
+		w.mu.RUnlock()
+		if running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("build still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFailureStreakPause(t *testing.T) {
+	cfg := &config.Config{
+		BuildStatusDir: t.TempDir(),
+		BuildRules: []config.BuildRule{
+			{Name: "go-build", Command: config.Commands{"exit 1"}, Watch: []string{"**/*.go"}, MaxFailureStreak: 2},
+		},
+	}
+	w, clock, store, _ := newTestWatcher(t, cfg)
+	cfg.RunMode = config.RunModeBuild
+
+	var mu sync.Mutex
+	failures := 0
+	w.SetBuildFailureCallback(func(string, error) {
+		mu.Lock()
+		failures++
+		mu.Unlock()
+	})
+	failed := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return failures
+	}
+
+	// A save well after the previous build, so it isn't mistaken for the build's own output
+	save := func() {
+		clock.Advance(time.Second)
+		w.handleFileEvent(fsnotify.Event{Name: "main.go", Op: fsnotify.Write})
+		clock.Advance(100 * time.Millisecond)
+		waitForBuilds(t, w)
+	}
+
+	save()
+	save()
+	if n := failed(); n != 2 {
+		t.Fatalf("%d failure(s) after two saves, want 2", n)
+	}
+
+	// Changes written right after the failing build don't resume the rule
+	w.handleFileEvent(fsnotify.Event{Name: "main.go", Op: fsnotify.Write})
+	if state := ruleState(store, "go-build"); state == build.RuleQueued {
+		t.Error("paused rule queued by a change right after its build")
+	}
+
+	// Nor do builds queued before the pause
+	queued := func() {
+		w.executeBuild(&pendingBuild{name: "go-build"})
+		waitForBuilds(t, w)
+	}
+	queued()
+	if n := failed(); n != 2 {
+		t.Fatalf("paused rule built %d more time(s)", n-2)
+	}
+
+	// The next save retries it with a fresh streak, so one more failure doesn't pause it
+	save()
+	queued()
+	if n := failed(); n != 4 {
+		t.Fatalf("%d failure(s) after resuming, want 4", n)
+	}
+	queued()
+	if n := failed(); n != 4 {
+		t.Errorf("rule built again after failing twice since resuming")
+	}
+}
+
+func TestGuardRunsOnceForDeferredBuild(t *testing.T) {
+	guards := filepath.Join(t.TempDir(), "guards")
+	cfg := &config.Config{
+		BuildStatusDir: t.TempDir(),
+		BuildRules: []config.BuildRule{
+			{Name: "db", Command: config.Commands{"sleep 0.2"}},
+			{Name: "docker", Command: config.Commands{"true"}, WhenCmd: "echo checked >> " + guards, SerializeWith: []string{"db"}},
+		},
+	}
+	w, _, _, _ := newTestWatcher(t, cfg)
+	cfg.RunMode = config.RunModeBuild
+
+	built := make(chan string, 2)
+	w.SetBuildSuccessCallback(func(rule string) { built <- rule })
+
+	// docker waits for db, and only checks its when_cmd once it is about to build
+	w.executeBuild(&pendingBuild{name: "db"})
+	w.executeBuild(&pendingBuild{name: "docker"})
+	for range 2 {
+		select {
+		case <-built:
+		case <-time.After(5 * time.Second):
+			t.Fatal("builds didn't finish")
+		}
+	}
+
+	data, err := os.ReadFile(guards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "checked"); n != 1 {
+		t.Errorf("when_cmd ran %d times, want once", n)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	cfg := &config.Config{
+		BuildStatusDir: t.TempDir(),
+		BuildRules: []config.BuildRule{
+			{Name: "go-build", Command: config.Commands{"true"}},
+			{Name: "assets", Command: config.Commands{"sleep 10"}},
+		},
+	}
+	w, clock, store, _ := newTestWatcher(t, cfg)
+	cfg.RunMode = config.RunModeBuild
+
+	// assets is building and go-build waiting for its debounce delay
+	w.executeBuild(&pendingBuild{name: "assets"})
+	w.debounceBuild(&cfg.BuildRules[0], "main.go", false)
+
+	next := &config.Config{
+		BuildStatusDir: cfg.BuildStatusDir,
+		BuildRules:     []config.BuildRule{{Name: "go-build", Command: config.Commands{"echo reloaded"}}},
+	}
+	if err := w.UpdateConfig(next); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+
+	// The build of the removed rule is stopped
+	waitForBuilds(t, w)
+	if rule := w.rule("assets"); rule != nil {
+		t.Error("removed rule still present")
+	}
+	if rule := w.rule("go-build"); rule == nil || rule.Command[0] != "echo reloaded" {
+		t.Errorf("go-build = %+v, want the reloaded rule", rule)
+	}
+	if state := ruleState(store, "assets"); state != "" {
+		t.Errorf("store still reports the removed rule as %q", state)
+	}
+
+	// The config the watcher was created with isn't changed in place
+	if len(cfg.BuildRules) != 2 || cfg.BuildRules[0].Command[0] != "true" {
+		t.Errorf("original config changed to %+v", cfg.BuildRules)
+	}
+
+	// The pending build of the kept rule still happens, with its new command
+	built := make(chan string, 1)
+	w.SetBuildSuccessCallback(func(rule string) { built <- rule })
+	w.SetBuildFailureCallback(func(rule string, err error) { built <- rule })
+	clock.Advance(100 * time.Millisecond)
+	select {
+	case rule := <-built:
+		if rule != "go-build" {
+			t.Errorf("built %s, want go-build", rule)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pending build of go-build didn't run")
+	}
+}